@@ -1,61 +1,105 @@
 package vpcapi
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 	"strconv"
+	"sync/atomic"
 	"time"
 )
 
-// PickInterface pick an interface from given interfaces with policy
-func PickInterface(conf VPC, interfaces []DescribeInterfacesNetworkInterface) int {
-	ipCount := 1000
-	choseIndex := -1
-	for idx, intf := range interfaces {
-		if conf.Policy == VPCPolicyExclusive {
-			if intf.Primary {
-				continue
-			}
-			if len(intf.PrivateIPAddressSet) == 1 {
-				return idx
-			}
-		} else {
-			if conf.Policy != VPCPolicySharePrimary && intf.Primary {
-				continue
-			}
-			curIPCount := len(intf.PrivateIPAddressSet)
-			if curIPCount < ipCount {
-				ipCount = curIPCount
-				choseIndex = idx
-			}
-		}
-	}
-	if choseIndex >= 0 {
-		log.Printf("VPC.API: chose interface %v", interfaces[choseIndex])
+const (
+	// maxIPsPerAssign is the max number of IPs can be assigned by one AssignPrivateIpAddresses request
+	maxIPsPerAssign = 10
+	// maxIPsPerRelease is the max number of IPs can be released by one UnassignPrivateIpAddresses request
+	maxIPsPerRelease = 10
+)
+
+// PickInterface pick an interface from given interfaces with picker of client, returns index of the chosen interface
+// and the reason of the choice, or *NoCapacityError if no interface can be used
+func (c *Client) PickInterface(req *PickRequest) (int, string, error) {
+	idx, reason, err := c.picker.Pick(req)
+	if err != nil {
+		return -1, "", err
 	}
-	return choseIndex
+	c.logger.Printf("VPC.API: chose interface %v, since: %s", req.Interfaces[idx], reason)
+	return idx, reason, nil
 }
 
 // GetInstanceID get CVM instance ID based on given nodeIP
-func GetInstanceID(conf VPC, nodeIP string) (string, error) {
-	params := map[string]string{
-		"Action":             "DescribeInstances",
-		"Limit":              "1",
-		"Version":            "2017-03-12",
-		"Service":            "cvm",
-		"private-ip-address": nodeIP,
-	}
-	resp, err := doRequest(conf, params)
+func (c *Client) GetInstanceID(ctx context.Context, nodeIP string) (string, error) {
+	instance, err := c.GetInstance(ctx, nodeIP)
 	if err != nil {
 		return "", err
 	}
-	cvmResp := &CVMDescribeInstancesResponse{}
-	if err = json.Unmarshal(resp, cvmResp); err != nil {
-		return "", err
+	return instance.InstanceID, nil
+}
+
+// GetInstance get CVM instance based on given nodeIP. If more than one instances found, e.g. same IP in different vpc,
+// they are narrowed down by vpc ID in config, *AmbiguousError is returned if still more than one left.
+func (c *Client) GetInstance(ctx context.Context, nodeIP string) (*Instance, error) {
+	matches := []CVMDescribeInstancesInstance{}
+	err := c.ForEachInstance(ctx, InstanceFilter{PrivateIPAddress: nodeIP}, func(instance *CVMDescribeInstancesInstance) bool {
+		matches = append(matches, *instance)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) > 1 && c.conf.VPCID != "" {
+		inVPC := []CVMDescribeInstancesInstance{}
+		for _, instance := range matches {
+			if instance.VirtualPrivateCloud.VpcID == c.conf.VPCID {
+				inVPC = append(inVPC, instance)
+			}
+		}
+		matches = inVPC
+	}
+	if len(matches) == 0 {
+		return nil, &NotFoundError{Resource: "instance with IP", Key: nodeIP}
+	}
+	if len(matches) > 1 {
+		ids := []string{}
+		for _, instance := range matches {
+			ids = append(ids, instance.InstanceID)
+		}
+		return nil, &AmbiguousError{Resource: "instance with IP", Key: nodeIP, Matches: ids}
+	}
+	return c.newInstance(&matches[0]), nil
+}
+
+func (c *Client) newInstance(instance *CVMDescribeInstancesInstance) *Instance {
+	limit, ok := c.conf.InstanceTypeLimits[instance.InstanceType]
+	if !ok {
+		limit, _ = c.getCachedInterfaceLimit(instance.InstanceType)
+	}
+	return &Instance{
+		InstanceID:         instance.InstanceID,
+		InstanceType:       instance.InstanceType,
+		InstanceState:      instance.InstanceState,
+		Zone:               instance.Placement.Zone,
+		VpcID:              instance.VirtualPrivateCloud.VpcID,
+		SubnetID:           instance.VirtualPrivateCloud.SubnetID,
+		PrivateIPAddresses: instance.PrivateIPAddresses,
+		ENILimit:           limit.ENIQuantity,
+		IPPerENILimit:      limit.ENIPrivateIPAddressQuantity,
 	}
-	instanceID := cvmResp.Body.InstanceSet[0].InstanceID
-	return instanceID, nil
+}
+
+// diffIPs returns IPs in ips but not in origin
+func diffIPs(ips, origin []string) []string {
+	originSet := make(map[string]bool, len(origin))
+	for _, ip := range origin {
+		originSet[ip] = true
+	}
+	diff := []string{}
+	for _, ip := range ips {
+		if !originSet[ip] {
+			diff = append(diff, ip)
+		}
+	}
+	return diff
 }
 
 func getBaseParams(action, vpcID string) map[string]string {
@@ -72,10 +116,10 @@ func getDescribeNetworkInterfacesParams(vpcID string) map[string]string {
 }
 
 // GetInterface get cvm network interface by given interface ID
-func GetInterface(conf VPC, interfaceID string) (*DescribeInterfacesNetworkInterface, error) {
-	params := getDescribeNetworkInterfacesParams(conf.VPCID)
+func (c *Client) GetInterface(ctx context.Context, interfaceID string) (*DescribeInterfacesNetworkInterface, error) {
+	params := getDescribeNetworkInterfacesParams(c.conf.VPCID)
 	params["networkInterfaceId"] = interfaceID
-	resp, err := doRequest(conf, params)
+	resp, err := c.doRequest(ctx, params)
 	if err != nil {
 		return nil, err
 	}
@@ -83,7 +127,7 @@ func GetInterface(conf VPC, interfaceID string) (*DescribeInterfacesNetworkInter
 	if err = json.Unmarshal(resp, describeInterfacesResp); err != nil {
 		return nil, err
 	}
-	log.Printf("VPC.API: getInterface for %s: %v\n", interfaceID, describeInterfacesResp)
+	c.logger.Printf("VPC.API: getInterface for %s: %v\n", interfaceID, describeInterfacesResp)
 	if len(describeInterfacesResp.Data.Data) == 0 {
 		return nil, nil
 	}
@@ -91,25 +135,27 @@ func GetInterface(conf VPC, interfaceID string) (*DescribeInterfacesNetworkInter
 }
 
 // GetInterfaces get all network interfaces on the vpc
-func GetInterfaces(conf VPC) ([]DescribeInterfacesNetworkInterface, error) {
-	params := getDescribeNetworkInterfacesParams(conf.VPCID)
-	resp, err := doRequest(conf, params)
+func (c *Client) GetInterfaces(ctx context.Context) ([]DescribeInterfacesNetworkInterface, error) {
+	interfaces := []DescribeInterfacesNetworkInterface{}
+	err := c.ForEachInterface(ctx, InterfaceFilter{}, func(intf *DescribeInterfacesNetworkInterface) bool {
+		interfaces = append(interfaces, *intf)
+		return true
+	})
 	if err != nil {
 		return nil, err
 	}
-	describeInterfacesResp := &DescribeInterfacesResponse{}
-	if err = json.Unmarshal(resp, describeInterfacesResp); err != nil {
-		return nil, err
-	}
-	return describeInterfacesResp.Data.Data, nil
+	return interfaces, nil
 }
 
 // GetInterfaceIPs get network interface IPs by given interface ID
-func GetInterfaceIPs(conf VPC, interfaceID string) ([]string, error) {
-	intf, err := GetInterface(conf, interfaceID)
+func (c *Client) GetInterfaceIPs(ctx context.Context, interfaceID string) ([]string, error) {
+	intf, err := c.GetInterface(ctx, interfaceID)
 	if err != nil {
 		return nil, err
 	}
+	if intf == nil {
+		return nil, &NotFoundError{Resource: "interface", Key: interfaceID}
+	}
 	ips := []string{}
 	for _, ip := range intf.PrivateIPAddressSet {
 		if !ip.Primary {
@@ -119,152 +165,442 @@ func GetInterfaceIPs(conf VPC, interfaceID string) ([]string, error) {
 	return ips, nil
 }
 
-// GetInterfaceByIP get network interface by given interface IP
-func GetInterfaceByIP(conf VPC, ip string) (*DescribeInterfacesNetworkInterface, error) {
-	params := getDescribeNetworkInterfacesParams(conf.VPCID)
-	resp, err := doRequest(conf, params)
-	if err != nil {
-		return nil, err
-	}
-	describeInterfacesResp := &DescribeInterfacesResponse{}
-	if err = json.Unmarshal(resp, describeInterfacesResp); err != nil {
-		return nil, err
-	}
-	for _, intf := range describeInterfacesResp.Data.Data {
+// GetInterfaceByIP get network interface by given interface IP, either IPv4 or IPv6. IPv4 is sent as filter to API,
+// if API doesn't support the filter, all interfaces in the vpc will be scanned. IPv6 is always found by scanning,
+// since the filter only matches private IPv4 addresses.
+func (c *Client) GetInterfaceByIP(ctx context.Context, ip string) (*DescribeInterfacesNetworkInterface, error) {
+	filter := InterfaceFilter{}
+	if family, err := GetIPFamily(ip); err == nil && family == IPFamilyV4 && atomic.LoadInt32(&c.ipFilterUnsupported) == 0 {
+		filter.PrivateIPAddress = ip
+	}
+	intf, err := c.findInterfaceByIP(ctx, filter, ip)
+	if err != nil && filter.PrivateIPAddress != "" && isFilterUnsupported(err) {
+		c.logger.Printf("VPC.API: filter by IP is unsupported, will scan all interfaces, since: %v", err)
+		atomic.StoreInt32(&c.ipFilterUnsupported, 1)
+		return c.findInterfaceByIP(ctx, InterfaceFilter{}, ip)
+	}
+	return intf, err
+}
+
+func (c *Client) findInterfaceByIP(ctx context.Context, filter InterfaceFilter, ip string) (*DescribeInterfacesNetworkInterface, error) {
+	var found *DescribeInterfacesNetworkInterface
+	err := c.ForEachInterface(ctx, filter, func(intf *DescribeInterfacesNetworkInterface) bool {
 		for _, intfIP := range intf.PrivateIPAddressSet {
 			if intfIP.PrivateIPAddress == ip {
-				return &intf, nil
+				found = intf
+				return false
 			}
 		}
+		for _, intfIP := range intf.Ipv6AddressSet {
+			if sameIP(intfIP.Address, ip) {
+				found = intf
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
 	}
-	return nil, nil
+	return found, nil
 }
 
 // GetInstanceInterfaces get instance network interfaces by given instance ID
-func GetInstanceInterfaces(conf VPC, instanceID string) ([]DescribeInterfacesNetworkInterface, error) {
-	params := getDescribeNetworkInterfacesParams(conf.VPCID)
-	params["instanceId"] = instanceID
-	resp, err := doRequest(conf, params)
+func (c *Client) GetInstanceInterfaces(ctx context.Context, instanceID string) ([]DescribeInterfacesNetworkInterface, error) {
+	interfaces := []DescribeInterfacesNetworkInterface{}
+	err := c.ForEachInterface(ctx, InterfaceFilter{InstanceID: instanceID}, func(intf *DescribeInterfacesNetworkInterface) bool {
+		interfaces = append(interfaces, *intf)
+		return true
+	})
 	if err != nil {
 		return nil, err
 	}
-	describeInterfacesResp := &DescribeInterfacesResponse{}
-	if err = json.Unmarshal(resp, describeInterfacesResp); err != nil {
-		return nil, err
-	}
-	log.Printf("VPC.API: getInstanceInterfaces for %s: %v\n", instanceID, describeInterfacesResp)
-	return describeInterfacesResp.Data.Data, nil
+	c.logger.Printf("VPC.API: getInstanceInterfaces for %s: %v\n", instanceID, interfaces)
+	return interfaces, nil
 }
 
-func assignInferfaceSecondaryIP(conf VPC, interfaceID string) error {
-	params := getBaseParams("AssignPrivateIpAddresses", conf.VPCID)
+// assignInferfaceSecondaryIP returns the assigned IPs if response contains them
+func (c *Client) assignInferfaceSecondaryIP(ctx context.Context, interfaceID string, count int) ([]string, error) {
+	params := getBaseParams("AssignPrivateIpAddresses", c.conf.VPCID)
 	params["networkInterfaceId"] = interfaceID
-	params["secondaryPrivateIpAddressCount"] = "1"
-	resp, err := doRequest(conf, params)
+	params["secondaryPrivateIpAddressCount"] = strconv.Itoa(count)
+	resp, err := c.doRequest(ctx, params)
 	if err != nil {
-		return fmt.Errorf("VPC.API: assignInferfaceSecondaryIP doRequest failed with: %v", err)
+		return nil, fmt.Errorf("VPC.API: assignInferfaceSecondaryIP doRequest failed with: %w", err)
 	}
 	assignResp := PrivateIPAddressesActionResponse{}
 	if err := json.Unmarshal(resp, &assignResp); err != nil {
-		return fmt.Errorf("VPC.API: assignInferfaceSecondaryIP failed to do json unmarshal, since: %v", err)
+		return nil, fmt.Errorf("VPC.API: assignInferfaceSecondaryIP failed to do json unmarshal, since: %v", err)
 	}
-	if assignResp.Code != 0 {
-		return fmt.Errorf("VPC.API: assignInferfaceSecondaryIP response error, code %d, message %s", assignResp.Code, assignResp.Message)
+	ips := []string{}
+	for _, ip := range assignResp.Data.PrivateIPAddressSet {
+		ips = append(ips, ip.PrivateIPAddress)
 	}
-	return err
+	return ips, nil
 }
-func releaseInterfaceSecondaryIP(conf VPC, interfaceID, podIP string) error {
-	params := getBaseParams("UnassignPrivateIpAddresses", conf.VPCID)
+
+func (c *Client) assignInterfaceSpecificIPs(ctx context.Context, interfaceID string, ips []string) error {
+	params := getBaseParams("AssignPrivateIpAddresses", c.conf.VPCID)
+	params["networkInterfaceId"] = interfaceID
+	for idx, ip := range ips {
+		params[fmt.Sprintf("privateIpAddress.%d", idx)] = ip
+	}
+	resp, err := c.doRequest(ctx, params)
+	if err != nil {
+		return fmt.Errorf("VPC.API: assignInterfaceSpecificIPs doRequest failed with: %w", err)
+	}
+	assignResp := PrivateIPAddressesActionResponse{}
+	if err := json.Unmarshal(resp, &assignResp); err != nil {
+		return fmt.Errorf("VPC.API: assignInterfaceSpecificIPs failed to do json unmarshal, since: %v", err)
+	}
+	return nil
+}
+
+func (c *Client) releaseInterfaceSecondaryIP(ctx context.Context, interfaceID string, podIPs []string) error {
+	params := getBaseParams("UnassignPrivateIpAddresses", c.conf.VPCID)
 	params["networkInterfaceId"] = interfaceID
-	params["privateIpAddress.0"] = podIP
-	resp, err := doRequest(conf, params)
+	for idx, ip := range podIPs {
+		params[fmt.Sprintf("privateIpAddress.%d", idx)] = ip
+	}
+	resp, err := c.doRequest(ctx, params)
 	if err != nil {
-		return fmt.Errorf("VPC.API: releaseInferfaceSecondaryIP doRequest failed with: %v", err)
+		return fmt.Errorf("VPC.API: releaseInferfaceSecondaryIP doRequest failed with: %w", err)
 	}
 	releaseResp := PrivateIPAddressesActionResponse{}
 	if err := json.Unmarshal(resp, &releaseResp); err != nil {
 		return fmt.Errorf("VPC.API: releaseInferfaceSecondaryIP failed to do json unmarshal, since: %v", err)
 	}
-	if releaseResp.Code != 0 {
-		return fmt.Errorf("VPC.API: releaseInferfaceSecondaryIP response error, code %d, message %s", releaseResp.Code, releaseResp.Message)
-	}
-	return err
+	return nil
 }
 
-func migrateInterfaceSecondaryIP(conf VPC, podIP, oldInterfaceID, newInterfaceID string) error {
-	params := getBaseParams("MigratePrivateIpAddress", conf.VPCID)
+func (c *Client) migrateInterfaceSecondaryIP(ctx context.Context, podIP, oldInterfaceID, newInterfaceID string) error {
+	params := getBaseParams("MigratePrivateIpAddress", c.conf.VPCID)
 	params["privateIpAddress"] = podIP
 	params["oldNetworkInterfaceId"] = oldInterfaceID
 	params["newNetworkInterfaceId"] = newInterfaceID
-	resp, err := doRequest(conf, params)
+	resp, err := c.doRequest(ctx, params)
 	if err != nil {
-		return fmt.Errorf("VPC.API: migrateInferfaceSecondaryIP doRequest failed with: %v", err)
+		return fmt.Errorf("VPC.API: migrateInferfaceSecondaryIP doRequest failed with: %w", err)
 	}
 	migrateResp := PrivateIPAddressesActionResponse{}
 	if err := json.Unmarshal(resp, &migrateResp); err != nil {
 		return fmt.Errorf("VPC.API: migrateInferfaceSecondaryIP failed to do json unmarshal, since: %v", err)
 	}
-	if migrateResp.Code != 0 {
-		return fmt.Errorf("VPC.API: migrateInferfaceSecondaryIP response error, code %d, message %s", migrateResp.Code, migrateResp.Message)
-	}
 
-	for i := 0; i != conf.IPMigrate.PostCheckRetry; i++ {
-		intf, err := GetInterface(conf, newInterfaceID)
+	for i := 0; i != c.conf.IPMigrate.PostCheckRetry; i++ {
+		intf, err := c.GetInterface(ctx, newInterfaceID)
 		if err != nil {
-			return fmt.Errorf("VPC.API: migrateInferfaceSecondaryIP failed to getInterface to detect, since: %v", err)
+			return fmt.Errorf("VPC.API: migrateInferfaceSecondaryIP failed to getInterface to detect, since: %w", err)
+		}
+		if intf == nil {
+			return &NotFoundError{Resource: "interface", Key: newInterfaceID}
 		}
 		for _, ip := range intf.PrivateIPAddressSet {
 			if ip.PrivateIPAddress == podIP {
 				return nil
 			}
 		}
-		time.Sleep(time.Duration(conf.IPMigrate.PostCheckInterval) * time.Millisecond)
+		if err := c.sleep(ctx, time.Duration(c.conf.IPMigrate.PostCheckInterval)*time.Millisecond); err != nil {
+			return err
+		}
 	}
-	return fmt.Errorf("VPC.API: after %d * %dms detect, ip failed to migrate to new interface", conf.IPMigrate.PostCheckRetry, conf.IPMigrate.PostCheckInterval)
+	return fmt.Errorf("VPC.API: after %d * %dms detect, %w", c.conf.IPMigrate.PostCheckRetry, c.conf.IPMigrate.PostCheckInterval, errMigrateNotDetected)
 }
 
-// AssignIP will invoke VPC API to assign an IP to given interface
-func AssignIP(conf VPC, interfaceID string) error {
+// AssignIP will invoke VPC API to assign an IP to given interface, and returns the new assigned IP and MAC address of
+// the interface. If the response doesn't contain the new assigned IP, interface IPs will be detected with ipDetect
+// settings to find it out.
+func (c *Client) AssignIP(ctx context.Context, interfaceID string) (string, string, error) {
+	unlock, err := c.lockInterfaces(ctx, interfaceID)
+	if err != nil {
+		return "", "", err
+	}
+	defer unlock()
+	intf, err := c.GetInterface(ctx, interfaceID)
+	if err != nil {
+		return "", "", err
+	}
+	if intf == nil {
+		return "", "", &NotFoundError{Resource: "interface", Key: interfaceID}
+	}
+	originIPs := []string{}
+	for _, ip := range intf.PrivateIPAddressSet {
+		originIPs = append(originIPs, ip.PrivateIPAddress)
+	}
+
 	// the API is weak, if we invoke it frequently, error like "您操作的资源正在执行其他操作，请稍后重试" will raise
-	ok := false
-	var err error
-	for i := 0; i != conf.IPAssign.Retry; i++ {
-		err = assignInferfaceSecondaryIP(conf, interfaceID)
-		if err == nil {
-			ok = true
+	policy := c.getRetryPolicy(c.conf.IPAssign.Retry, c.conf.IPAssign.Interval)
+	assignedIPs, err := c.retryAssign(ctx, policy, originIPs, 1, func() ([]string, error) {
+		return c.GetInterfaceIPs(ctx, interfaceID)
+	}, func() ([]string, error) {
+		return c.assignInferfaceSecondaryIP(ctx, interfaceID, 1)
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("VPC.API: failed to assign secondary IP for interface %s, since: %w", interfaceID, err)
+	}
+	if len(assignedIPs) > 0 {
+		return assignedIPs[0], intf.MacAddress, nil
+	}
+	ip, err := c.detectNewIP(ctx, interfaceID, originIPs)
+	if err != nil {
+		return "", "", err
+	}
+	return ip, intf.MacAddress, nil
+}
+
+// retryAssign retries count based assignment by assign with policy. The assignment isn't idempotent, and an attempt
+// timed out may have succeeded on server side, so before retrying it, IPs got by current are compared with originIPs,
+// and it's taken as succeeded if at least want new IPs are found, rather than assigning again and leaking IPs.
+func (c *Client) retryAssign(ctx context.Context, policy RetryPolicy, originIPs []string, want int,
+	current func() ([]string, error), assign func() ([]string, error)) ([]string, error) {
+	var assigned []string
+	timedOut := false
+	err := c.retry(ctx, policy, func(int) error {
+		if timedOut {
+			ips, err := current()
+			if err != nil {
+				return err
+			}
+			if newIPs := diffIPs(ips, originIPs); len(newIPs) >= want {
+				c.logger.Printf("VPC.API: assignment timed out but succeeded, new IPs %v found", newIPs)
+				assigned = newIPs
+				return nil
+			}
+		}
+		var err error
+		assigned, err = assign()
+		timedOut = IsTimeout(err)
+		return err
+	})
+	return assigned, err
+}
+
+// missingIPs returns IPs in ips but not on given interface currently
+func (c *Client) missingIPs(ctx context.Context, interfaceID string, ips []string) ([]string, error) {
+	current, err := c.GetInterfaceIPs(ctx, interfaceID)
+	if err != nil {
+		return nil, err
+	}
+	missing := []string{}
+	for _, ip := range ips {
+		found := false
+		for _, currentIP := range current {
+			if sameIP(ip, currentIP) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, ip)
+		}
+	}
+	return missing, nil
+}
+
+// detectNewIP polls interface IPs with ipDetect settings, until an IP not in originIPs found
+func (c *Client) detectNewIP(ctx context.Context, interfaceID string, originIPs []string) (string, error) {
+	if err := c.sleep(ctx, time.Duration(c.conf.IPDetect.Delay)*time.Millisecond); err != nil {
+		return "", err
+	}
+	for i := 0; i == 0 || i < c.conf.IPDetect.Retry; i++ {
+		if i > 0 {
+			if err := c.sleep(ctx, time.Duration(c.conf.IPDetect.Interval)*time.Millisecond); err != nil {
+				return "", err
+			}
+		}
+		ips, err := c.GetInterfaceIPs(ctx, interfaceID)
+		if err != nil {
+			c.logger.Printf("VPC.API: failed to get IPs of interface %s to detect new IP, since: %v", interfaceID, err)
+			continue
+		}
+		if newIPs := diffIPs(ips, originIPs); len(newIPs) > 0 {
+			return newIPs[0], nil
+		}
+	}
+	return "", fmt.Errorf("VPC.API: after %d * %dms detect, no new IP found on interface %s", c.conf.IPDetect.Retry, c.conf.IPDetect.Interval, interfaceID)
+}
+
+// AssignIPCount will invoke VPC API to assign count IPs to given interface, and returns the new assigned IPs. IPs are
+// assigned by chunks of maxIPsPerAssign, if any chunk fails, IPs already assigned are returned with the error.
+func (c *Client) AssignIPCount(ctx context.Context, interfaceID string, count int) ([]string, error) {
+	unlock, err := c.lockInterfaces(ctx, interfaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	originIPs, err := c.GetInterfaceIPs(ctx, interfaceID)
+	if err != nil {
+		return nil, err
+	}
+	policy := c.getRetryPolicy(c.conf.IPAssign.Retry, c.conf.IPAssign.Interval)
+	var assignErr error
+	for assigned := 0; assigned < count; assigned += maxIPsPerAssign {
+		chunk := count - assigned
+		if chunk > maxIPsPerAssign {
+			chunk = maxIPsPerAssign
+		}
+		_, assignErr = c.retryAssign(ctx, policy, originIPs, assigned+chunk, func() ([]string, error) {
+			return c.GetInterfaceIPs(ctx, interfaceID)
+		}, func() ([]string, error) {
+			return c.assignInferfaceSecondaryIP(ctx, interfaceID, chunk)
+		})
+		if assignErr != nil {
 			break
 		}
-		time.Sleep(time.Duration(conf.IPAssign.Interval) * time.Millisecond)
 	}
-	if !ok {
-		return fmt.Errorf("VPC.API: failed to assign secondary IP for interface %s, since: %v", interfaceID, err)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
 	}
-	return nil
+	ips, err := c.GetInterfaceIPs(ctx, interfaceID)
+	if err != nil {
+		return nil, err
+	}
+	newIPs := diffIPs(ips, originIPs)
+	if assignErr != nil {
+		return newIPs, fmt.Errorf("VPC.API: failed to assign %d secondary IPs for interface %s, %d assigned, since: %w", count, interfaceID, len(newIPs), assignErr)
+	}
+	return newIPs, nil
+}
+
+// AssignIPs will invoke VPC API to assign given IPs to given interface, it's used to claim IPs back for pods with
+// AnnoKeyVPCIPRetain. IPs are assigned by chunks of maxIPsPerAssign, if a chunk fails, each IP of it will be assigned
+// separately, so callers can tell which IPs are claimed by results. Error is returned if any IP failed to be assigned.
+func (c *Client) AssignIPs(ctx context.Context, interfaceID string, ips []string) ([]AssignIPResult, error) {
+	unlock, err := c.lockInterfaces(ctx, interfaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	results := make([]AssignIPResult, len(ips))
+	// valid holds indexes of valid IPs in results
+	valid := []int{}
+	for idx, ip := range ips {
+		results[idx].IP = ip
+		family, err := GetIPFamily(ip)
+		if err != nil {
+			results[idx].Err = err
+			continue
+		}
+		if family != IPFamilyV4 {
+			results[idx].Err = fmt.Errorf("VPC.API: IP %s is not IPv4, it should be assigned by AssignIPv6s", ip)
+			continue
+		}
+		valid = append(valid, idx)
+	}
+	policy := c.getRetryPolicy(c.conf.IPAssign.Retry, c.conf.IPAssign.Interval)
+	assign := func(ips []string) error {
+		timedOut := false
+		return c.retry(ctx, policy, func(int) error {
+			// an attempt timed out may have succeeded on server side, retrying it would fail since IPs are in use
+			if timedOut {
+				if missing, err := c.missingIPs(ctx, interfaceID, ips); err == nil && len(missing) == 0 {
+					c.logger.Printf("VPC.API: assignment timed out but succeeded, IPs %v found on %s", ips, interfaceID)
+					return nil
+				}
+			}
+			err := c.assignInterfaceSpecificIPs(ctx, interfaceID, ips)
+			timedOut = IsTimeout(err)
+			return err
+		})
+	}
+	for start := 0; start < len(valid); start += maxIPsPerAssign {
+		end := start + maxIPsPerAssign
+		if end > len(valid) {
+			end = len(valid)
+		}
+		chunk := []string{}
+		for _, idx := range valid[start:end] {
+			chunk = append(chunk, results[idx].IP)
+		}
+		err := assign(chunk)
+		if ctx.Err() != nil {
+			return results, ctx.Err()
+		}
+		if err != nil && len(chunk) > 1 {
+			c.logger.Printf("VPC.API: failed to assign IPs %v on %s, will assign them one by one, since: %v", chunk, interfaceID, err)
+			// IPs of the chunk may be partially assigned, only assign those missing on the interface
+			missing, err := c.missingIPs(ctx, interfaceID, chunk)
+			if err != nil {
+				c.logger.Printf("VPC.API: failed to get IPs of interface %s, will assign all IPs %v, since: %v", interfaceID, chunk, err)
+				missing = chunk
+			}
+			for _, idx := range valid[start:end] {
+				for _, ip := range missing {
+					if ip == results[idx].IP {
+						results[idx].Err = assign([]string{ip})
+						break
+					}
+				}
+			}
+		} else if err != nil {
+			results[valid[start]].Err = err
+		}
+	}
+	if ctx.Err() != nil {
+		return results, ctx.Err()
+	}
+	failed := []string{}
+	for _, result := range results {
+		if result.Err != nil {
+			failed = append(failed, result.IP)
+		}
+	}
+	if len(failed) > 0 {
+		return results, fmt.Errorf("VPC.API: failed to assign IPs %v on interface %s", failed, interfaceID)
+	}
+	return results, nil
 }
 
 // ReleaseIP will invoke VPC API to release IP on given interface
-func ReleaseIP(conf VPC, interfaceID, podIP string) error {
+func (c *Client) ReleaseIP(ctx context.Context, interfaceID, podIP string) error {
+	unlock, err := c.lockInterfaces(ctx, interfaceID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	// the API is weak, if we invoke it frequently, error like "您操作的资源正在执行其他操作，请稍后重试" will raise
-	ok := false
-	var err error
-	for i := 0; i != conf.IPRelease.Retry; i++ {
-		err = releaseInterfaceSecondaryIP(conf, interfaceID, podIP)
-		if err == nil {
-			ok = true
-			break
-		}
-		time.Sleep(time.Duration(conf.IPRelease.Interval) * time.Millisecond)
+	policy := c.getRetryPolicy(c.conf.IPRelease.Retry, c.conf.IPRelease.Interval)
+	err = c.retry(ctx, policy, func(int) error {
+		return c.releaseInterfaceSecondaryIP(ctx, interfaceID, []string{podIP})
+	})
+	if err != nil {
+		return fmt.Errorf("VPC.API: failed to release IP %s on %s, since: %w", podIP, interfaceID, err)
 	}
-	if !ok {
-		return fmt.Errorf("VPC.API: failed to release IP %s on %s, since: %v", podIP, interfaceID, err)
+	return nil
+}
+
+// ReleaseIPs will invoke VPC API to release given IPs on given interface, by chunks of maxIPsPerRelease
+func (c *Client) ReleaseIPs(ctx context.Context, interfaceID string, podIPs []string) error {
+	unlock, err := c.lockInterfaces(ctx, interfaceID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	policy := c.getRetryPolicy(c.conf.IPRelease.Retry, c.conf.IPRelease.Interval)
+	for start := 0; start < len(podIPs); start += maxIPsPerRelease {
+		end := start + maxIPsPerRelease
+		if end > len(podIPs) {
+			end = len(podIPs)
+		}
+		chunk := podIPs[start:end]
+		err := c.retry(ctx, policy, func(int) error {
+			return c.releaseInterfaceSecondaryIP(ctx, interfaceID, chunk)
+		})
+		if err != nil {
+			return fmt.Errorf("VPC.API: failed to release IPs %v on %s, since: %w", chunk, interfaceID, err)
+		}
 	}
 	return nil
 }
 
-func CheckMigrateIPStatus(conf VPC, podIP, oldInterfaceID, newInterfaceID string) error {
-	intf, err := GetInterfaceByIP(conf, podIP)
+// CheckMigrateIPStatus checks whether given pod IP has been migrated from old interface to new interface
+func (c *Client) CheckMigrateIPStatus(ctx context.Context, podIP, oldInterfaceID, newInterfaceID string) error {
+	intf, err := c.GetInterfaceByIP(ctx, podIP)
 	if err != nil {
-		return fmt.Errorf("VPC.API: getInterfaceByIP doRequest failed with: %v", err)
+		return fmt.Errorf("VPC.API: getInterfaceByIP doRequest failed with: %w", err)
+	}
+	if intf == nil {
+		return &NotFoundError{Resource: "interface with IP", Key: podIP}
 	}
 	if intf.NetworkInterfaceID == oldInterfaceID {
 		return fmt.Errorf("VPC.API: Migrate IP %s failed, retry once more", podIP)
@@ -276,29 +612,27 @@ func CheckMigrateIPStatus(conf VPC, podIP, oldInterfaceID, newInterfaceID string
 }
 
 // MigrateIP will invoke VPC API to migrate IP from old interface to new interface
-func MigrateIP(conf VPC, ip, oldInterfaceID, newInterfaceID string) error {
+func (c *Client) MigrateIP(ctx context.Context, ip, oldInterfaceID, newInterfaceID string) error {
+	unlock, err := c.lockInterfaces(ctx, oldInterfaceID, newInterfaceID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	// the API is weak, if we invoke it frequently, error like "您操作的资源正在执行其他操作，请稍后重试" will raise
-	ok := false
-	var err error
-	for i := 0; i != conf.IPMigrate.Retry; i++ {
-		if i > 0 {
-			err = CheckMigrateIPStatus(conf, ip, oldInterfaceID, newInterfaceID)
+	policy := c.getRetryPolicy(c.conf.IPMigrate.Retry, c.conf.IPMigrate.Interval)
+	err = c.retry(ctx, policy, func(attempt int) error {
+		if attempt > 0 {
+			err := c.CheckMigrateIPStatus(ctx, ip, oldInterfaceID, newInterfaceID)
 			if err == nil {
-				log.Printf("VPC.API: at No.%s retry, migrate IP already done.", strconv.Itoa(i))
-				ok = true
-				break
+				c.logger.Printf("VPC.API: at No.%s retry, migrate IP already done.", strconv.Itoa(attempt))
+				return nil
 			}
-			log.Printf("VPC.API: check migrate IP status with error: %s", err.Error())
+			c.logger.Printf("VPC.API: check migrate IP status with error: %s", err.Error())
 		}
-		err = migrateInterfaceSecondaryIP(conf, ip, oldInterfaceID, newInterfaceID)
-		if err == nil {
-			ok = true
-			break
-		}
-		time.Sleep(time.Duration(conf.IPMigrate.Interval) * time.Millisecond)
-	}
-	if !ok {
-		return fmt.Errorf("VPC.API: failed to migrate Pod IP %s between intefaces, %s => %s, since: %v", ip, oldInterfaceID, newInterfaceID, err)
+		return c.migrateInterfaceSecondaryIP(ctx, ip, oldInterfaceID, newInterfaceID)
+	})
+	if err != nil {
+		return fmt.Errorf("VPC.API: failed to migrate Pod IP %s between intefaces, %s => %s, since: %w", ip, oldInterfaceID, newInterfaceID, err)
 	}
 	return nil
 }
@@ -0,0 +1,219 @@
+package vpcapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// BreakerClosed means requests are sent as usual
+	BreakerClosed BreakerState = "closed"
+	// BreakerOpen means requests fail fast with *CircuitOpenError without being sent
+	BreakerOpen BreakerState = "open"
+	// BreakerHalfOpen means limited trial requests are sent to tell whether the endpoint recovers
+	BreakerHalfOpen BreakerState = "half-open"
+
+	defaultBreakerOpenTimeout = 30 * time.Second
+)
+
+// BreakerState is state of a circuit breaker
+type BreakerState string
+
+// BreakerConfig defines circuit breakers per endpoint and action. After FailureThreshold consecutive failures, like
+// timeouts, network errors and server side errors, the breaker opens, and requests fail fast for OpenTimeout; then
+// it half-opens to let HalfOpenRequests trial requests through, it closes if they succeed, otherwise opens again.
+type BreakerConfig struct {
+	// FailureThreshold is the number of consecutive failures to open the breaker, 0 disables the breaker
+	FailureThreshold int `json:"failureThreshold,omitempty"`
+	// OpenTimeout is time in ms the breaker keeps open before half-opens, default to 30000
+	OpenTimeout int `json:"openTimeout,omitempty"`
+	// HalfOpenRequests is the max number of trial requests at the same time when half-open, default to 1
+	HalfOpenRequests int `json:"halfOpenRequests,omitempty"`
+}
+
+// BreakerStatus is status of the circuit breaker of an endpoint and action, for health checks
+type BreakerStatus struct {
+	Endpoint            string
+	Action              string
+	State               BreakerState
+	ConsecutiveFailures int
+	// OpenedAt is when the breaker opened last time, zero if never
+	OpenedAt time.Time
+}
+
+// CircuitOpenError is returned without sending request, when circuit breaker of the endpoint and action is open
+type CircuitOpenError struct {
+	Endpoint   string
+	Action     string
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("VPC.API: circuit breaker of %s on %s is open, retry after %v", e.Action, e.Endpoint, e.RetryAfter)
+}
+
+// IsCircuitOpen tells whether err is caused by circuit breaker is open
+func IsCircuitOpen(err error) bool {
+	openErr := &CircuitOpenError{}
+	return errors.As(err, &openErr)
+}
+
+// isEndpointFailure tells whether err means the endpoint is degraded, rather than the request itself is wrong
+func isEndpointFailure(err error) bool {
+	if IsTimeout(err) {
+		return true
+	}
+	statusErr := &HTTPStatusError{}
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= http.StatusInternalServerError || statusErr.StatusCode == http.StatusTooManyRequests
+	}
+	if apiErr, ok := asAPIError(err); ok {
+		return apiErr.HTTPStatus >= http.StatusInternalServerError || strings.HasPrefix(apiErr.CodeDesc, "InternalError")
+	}
+	return isTransientNetError(err)
+}
+
+type circuitBreaker struct {
+	endpoint string
+	action   string
+
+	mutex    sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	trials   int
+}
+
+// circuitBreakers holds circuit breakers keyed by endpoint and action, thresholds and timeouts are given by clients
+// on each request, since breakers are shared by clients
+type circuitBreakers struct {
+	mutex    sync.Mutex
+	breakers map[string]*circuitBreaker
+}
+
+// processCircuitBreakers holds breakers of all endpoints for the process, since failures counted by a short-lived
+// client would be lost with it, and an endpoint down would never be seen as down
+var processCircuitBreakers = &circuitBreakers{breakers: map[string]*circuitBreaker{}}
+
+func (bs *circuitBreakers) get(endpoint, action string) *circuitBreaker {
+	key := endpoint + "/" + action
+	bs.mutex.Lock()
+	defer bs.mutex.Unlock()
+	breaker, ok := bs.breakers[key]
+	if !ok {
+		breaker = &circuitBreaker{endpoint: endpoint, action: action, state: BreakerClosed}
+		bs.breakers[key] = breaker
+	}
+	return breaker
+}
+
+func (conf BreakerConfig) openTimeout() time.Duration {
+	if conf.OpenTimeout > 0 {
+		return time.Duration(conf.OpenTimeout) * time.Millisecond
+	}
+	return defaultBreakerOpenTimeout
+}
+
+// allow returns *CircuitOpenError if request of given endpoint and action can't be sent, otherwise done must be
+// called with result of the request
+func (bs *circuitBreakers) allow(conf BreakerConfig, clock Clock, endpoint, action string) (func(err error), error) {
+	breaker := bs.get(endpoint, action)
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+	now := clock.Now()
+	if breaker.state == BreakerOpen {
+		if retryAfter := breaker.openedAt.Add(conf.openTimeout()).Sub(now); retryAfter > 0 {
+			return nil, &CircuitOpenError{Endpoint: endpoint, Action: action, RetryAfter: retryAfter}
+		}
+		breaker.state = BreakerHalfOpen
+		breaker.trials = 0
+	}
+	trial := breaker.state == BreakerHalfOpen
+	if trial {
+		maxTrials := conf.HalfOpenRequests
+		if maxTrials <= 0 {
+			maxTrials = 1
+		}
+		if breaker.trials >= maxTrials {
+			return nil, &CircuitOpenError{Endpoint: endpoint, Action: action}
+		}
+		breaker.trials++
+	}
+	return func(err error) {
+		breaker.record(conf, clock, trial, err)
+	}, nil
+}
+
+func (breaker *circuitBreaker) record(conf BreakerConfig, clock Clock, trial bool, err error) {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+	if trial {
+		breaker.trials--
+	}
+	if !IsTimeout(err) && (errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)) {
+		// caller gave up, tells nothing about the endpoint
+		return
+	}
+	if !isEndpointFailure(err) {
+		breaker.failures = 0
+		if trial || breaker.state == BreakerHalfOpen {
+			breaker.state = BreakerClosed
+		}
+		return
+	}
+	breaker.failures++
+	if trial || breaker.failures >= conf.FailureThreshold {
+		if breaker.state != BreakerOpen {
+			breaker.openedAt = clock.Now()
+		}
+		breaker.state = BreakerOpen
+	}
+}
+
+func (bs *circuitBreakers) statuses() []BreakerStatus {
+	bs.mutex.Lock()
+	breakers := make([]*circuitBreaker, 0, len(bs.breakers))
+	for _, breaker := range bs.breakers {
+		breakers = append(breakers, breaker)
+	}
+	bs.mutex.Unlock()
+	statuses := []BreakerStatus{}
+	for _, breaker := range breakers {
+		breaker.mutex.Lock()
+		statuses = append(statuses, BreakerStatus{
+			Endpoint:            breaker.endpoint,
+			Action:              breaker.action,
+			State:               breaker.state,
+			ConsecutiveFailures: breaker.failures,
+			OpenedAt:            breaker.openedAt,
+		})
+		breaker.mutex.Unlock()
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].Endpoint != statuses[j].Endpoint {
+			return statuses[i].Endpoint < statuses[j].Endpoint
+		}
+		return statuses[i].Action < statuses[j].Action
+	})
+	return statuses
+}
+
+// BreakerStatuses returns status of circuit breakers for endpoints and actions requested in the process, nil if
+// circuit breaker is not enabled. It can be used by health checks, like reporting unhealthy if any breaker is open.
+func (c *Client) BreakerStatuses() []BreakerStatus {
+	if c.breakers == nil {
+		return nil
+	}
+	return c.breakers.statuses()
+}
+
+// allowRequest checks circuit breaker of given endpoint and action, see circuitBreakers.allow
+func (c *Client) allowRequest(endpoint, action string) (func(err error), error) {
+	return c.breakers.allow(*c.conf.CircuitBreaker, c.clock, endpoint, action)
+}
@@ -0,0 +1,313 @@
+package vpcapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/von1994/vpcapi/metadata"
+)
+
+// Logger is used by Client to print logs, *log.Logger satisfies it
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// Clock is used by Client to get current time and wait between retries
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+const (
+	defaultRequestTimeout      = 30 * time.Second
+	defaultMaxResponseBodySize = 10 << 20
+)
+
+var defaultLogger Logger = log.New(os.Stderr, "", log.LstdFlags)
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// Client is a reusable client for VPC and CVM API. It's safe for concurrent use, and should be created once and
+// shared, so the underlying http connections can be reused.
+type Client struct {
+	conf       VPC
+	httpClient *http.Client
+	logger     Logger
+	clock      Clock
+	signer     Signer
+	creds      CredentialProvider
+	metadata   *metadata.Client
+	picker     InterfacePicker
+	limiter    RateLimiter
+	breakers   *circuitBreakers
+
+	// localLocker serializes operations on interfaces in-process, interfaceLocker is optional to serialize them across
+	// processes
+	localLocker     *localInterfaceLocker
+	interfaceLocker InterfaceLocker
+
+	localMutex      sync.Mutex
+	localInstanceID string
+
+	// limits caches interface quota by instance type
+	limitsMutex sync.RWMutex
+	limits      map[string]InterfaceLimit
+
+	// ipFilterUnsupported is set to 1 once API reports that filter by IP is unsupported
+	ipFilterUnsupported int32
+}
+
+// Option defines optional settings for Client
+type Option func(*Client)
+
+// WithHTTPClient makes Client send requests with given http client
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithLogger makes Client print logs with given logger
+func WithLogger(logger Logger) Option {
+	return func(c *Client) {
+		c.logger = logger
+	}
+}
+
+// WithClock makes Client use given clock, mostly used by tests
+func WithClock(clock Clock) Option {
+	return func(c *Client) {
+		c.clock = clock
+	}
+}
+
+// WithSigner makes Client sign requests with given signer
+func WithSigner(signer Signer) Option {
+	return func(c *Client) {
+		c.signer = signer
+	}
+}
+
+// WithCredentialProvider makes Client sign requests with credential from given provider, instead of the one selected
+// by credentials in config. It's ignored if signer is set by WithSigner.
+func WithCredentialProvider(provider CredentialProvider) Option {
+	return func(c *Client) {
+		c.creds = provider
+	}
+}
+
+// WithInterfacePicker makes Client pick interfaces with given picker instead of the one selected by policy in config
+func WithInterfacePicker(picker InterfacePicker) Option {
+	return func(c *Client) {
+		c.picker = picker
+	}
+}
+
+// NewClient creates a new Client based on given vpc config and options
+func NewClient(conf VPC, opts ...Option) (*Client, error) {
+	c := &Client{conf: conf, limits: map[string]InterfaceLimit{}, localLocker: processInterfaceLocker}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.logger == nil {
+		c.logger = defaultLogger
+	}
+	if c.clock == nil {
+		c.clock = realClock{}
+	}
+	if c.httpClient == nil {
+		transport, err := newTransport(conf)
+		if err != nil {
+			return nil, err
+		}
+		if conf.TLS != nil && conf.TLS.InsecureSkipVerify {
+			c.logger.Printf("VPC.API: certificate verification of API endpoints is disabled by insecureSkipVerify")
+		}
+		c.httpClient = &http.Client{Transport: transport}
+	}
+	if c.metadata == nil {
+		c.metadata = metadata.NewClient(conf.MetadataEndpoint, nil)
+	}
+	if c.signer == nil {
+		if c.creds == nil {
+			creds, err := newCredentialProvider(conf, c.httpClient, c.metadata, c.clock)
+			if err != nil {
+				return nil, err
+			}
+			c.creds = creds
+		}
+		signer, err := newSigner(conf, c.clock, c.creds)
+		if err != nil {
+			return nil, err
+		}
+		c.signer = signer
+	}
+	if c.limiter == nil {
+		limiter, err := newRateLimiter(conf.RateLimit, c.clock)
+		if err != nil {
+			return nil, err
+		}
+		c.limiter = limiter
+	}
+	if conf.CircuitBreaker != nil && conf.CircuitBreaker.FailureThreshold > 0 {
+		c.breakers = processCircuitBreakers
+	}
+	if c.picker == nil {
+		picker, err := NewInterfacePicker(conf)
+		if err != nil {
+			// policies other than exclusive were treated as share, so keep configs with unknown policies working
+			c.logger.Printf("VPC.API: unknown interface picker policy %s, fall back to policy %s", conf.Policy, VPCPolicyShare)
+			shareConf := conf
+			shareConf.Policy = VPCPolicyShare
+			if picker, err = NewInterfacePicker(shareConf); err != nil {
+				return nil, err
+			}
+		}
+		c.picker = picker
+	}
+	return c, nil
+}
+
+// Config returns vpc config of client
+func (c *Client) Config() VPC {
+	return c.conf
+}
+
+func (c *Client) getEndpoint(params map[string]string) string {
+	endpoint := ""
+	if params["Service"] == "vpc" {
+		endpoint = c.conf.VPCAPIEndpoint + c.conf.V2URI
+	} else if params["Service"] == "cvm" {
+		endpoint = c.conf.CVMAPIEndpoint + c.conf.V3URI
+	}
+	return endpoint
+}
+
+func (c *Client) doRequest(ctx context.Context, params map[string]string) ([]byte, error) {
+	action := params["Action"]
+	endpoint := c.getEndpoint(params)
+	// wait before signing, so timestamp and nonce in signature aren't stale when sent after queuing, and before
+	// asking breaker, so a trial of half-open breaker isn't held while queuing
+	if c.limiter != nil {
+		release, err := c.limiter.Wait(ctx, action)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+	}
+	req, err := c.sign(ctx, endpoint, params)
+	if err != nil {
+		return nil, err
+	}
+	if c.breakers == nil {
+		return c.send(ctx, action, req)
+	}
+	done, err := c.allowRequest(endpoint, action)
+	if err != nil {
+		return nil, err
+	}
+	body, err := c.send(ctx, action, req)
+	done(err)
+	return body, err
+}
+
+// sign builds signed request of given params with signer of client
+func (c *Client) sign(ctx context.Context, endpoint string, params map[string]string) (*http.Request, error) {
+	formatFilter(params)
+	var req *http.Request
+	var err error
+	if signer, ok := c.signer.(ContextSigner); ok {
+		req, err = signer.SignContext(ctx, endpoint, params)
+	} else {
+		req, err = c.signer.Sign(endpoint, params)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("VPC.API: failed to sign request, since: %v", err)
+	}
+	return req, nil
+}
+
+// send sends signed request, and returns response body if the request succeeded
+func (c *Client) send(ctx context.Context, action string, req *http.Request) ([]byte, error) {
+	timeout := defaultRequestTimeout
+	if c.conf.RequestTimeout > 0 {
+		timeout = time.Duration(c.conf.RequestTimeout) * time.Millisecond
+	}
+	reqCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	resp, err := c.httpClient.Do(req.WithContext(reqCtx))
+	if err != nil {
+		c.logger.Printf("Fail exec http client Do,err:%s\n", err.Error())
+		return nil, requestError(ctx, reqCtx, action, timeout, err)
+	}
+	defer resp.Body.Close()
+	body, err := readResponseBody(resp.Body, action, c.conf.MaxResponseBodySize)
+	if err != nil {
+		return nil, requestError(ctx, reqCtx, action, timeout, err)
+	}
+	if err := checkResponse(action, resp.StatusCode, body); err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		if len(body) > maxErrorBodySize {
+			body = body[:maxErrorBodySize]
+		}
+		return nil, &HTTPStatusError{Action: action, StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	return body, nil
+}
+
+// readResponseBody reads response body of given action up to maxSize bytes, defaultMaxResponseBodySize is used if
+// maxSize is not positive
+func readResponseBody(body io.Reader, action string, maxSize int64) ([]byte, error) {
+	if maxSize <= 0 {
+		maxSize = defaultMaxResponseBodySize
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(body, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxSize {
+		return nil, fmt.Errorf("VPC.API: response of %s exceeds max size %d bytes", action, maxSize)
+	}
+	return data, nil
+}
+
+// requestError returns ctx.Err() if ctx is done, or *TimeoutError if request timed out, otherwise err itself
+func requestError(ctx, reqCtx context.Context, action string, timeout time.Duration, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	var netErr net.Error
+	if reqCtx.Err() != nil || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return &TimeoutError{Action: action, Timeout: timeout, Err: err}
+	}
+	return err
+}
+
+// sleep waits given duration, returns ctx.Err() if ctx is done before that
+func (c *Client) sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.clock.After(d):
+		return nil
+	}
+}
@@ -0,0 +1,113 @@
+package vpcapi
+
+import "context"
+
+// Package level functions below are kept for backward compatibility, each of them creates a new Client with given vpc
+// config for one call. New code should create a Client once with NewClient and reuse it.
+
+// PickInterface pick an interface from given interfaces with policy
+func PickInterface(conf VPC, interfaces []DescribeInterfacesNetworkInterface) int {
+	picker, err := NewInterfacePicker(conf)
+	if err != nil {
+		defaultLogger.Printf("VPC.API: failed to pick interface, since: %v", err)
+		return -1
+	}
+	idx, reason, err := picker.Pick(&PickRequest{Interfaces: interfaces})
+	if err != nil {
+		defaultLogger.Printf("VPC.API: failed to pick interface, since: %v", err)
+		return -1
+	}
+	defaultLogger.Printf("VPC.API: chose interface %v, since: %s", interfaces[idx], reason)
+	return idx
+}
+
+// GetInstanceID get CVM instance ID based on given nodeIP
+func GetInstanceID(conf VPC, nodeIP string) (string, error) {
+	c, err := NewClient(conf)
+	if err != nil {
+		return "", err
+	}
+	return c.GetInstanceID(context.Background(), nodeIP)
+}
+
+// GetInterface get cvm network interface by given interface ID
+func GetInterface(conf VPC, interfaceID string) (*DescribeInterfacesNetworkInterface, error) {
+	c, err := NewClient(conf)
+	if err != nil {
+		return nil, err
+	}
+	return c.GetInterface(context.Background(), interfaceID)
+}
+
+// GetInterfaces get all network interfaces on the vpc
+func GetInterfaces(conf VPC) ([]DescribeInterfacesNetworkInterface, error) {
+	c, err := NewClient(conf)
+	if err != nil {
+		return nil, err
+	}
+	return c.GetInterfaces(context.Background())
+}
+
+// GetInterfaceIPs get network interface IPs by given interface ID
+func GetInterfaceIPs(conf VPC, interfaceID string) ([]string, error) {
+	c, err := NewClient(conf)
+	if err != nil {
+		return nil, err
+	}
+	return c.GetInterfaceIPs(context.Background(), interfaceID)
+}
+
+// GetInterfaceByIP get network interface by given interface IP
+func GetInterfaceByIP(conf VPC, ip string) (*DescribeInterfacesNetworkInterface, error) {
+	c, err := NewClient(conf)
+	if err != nil {
+		return nil, err
+	}
+	return c.GetInterfaceByIP(context.Background(), ip)
+}
+
+// GetInstanceInterfaces get instance network interfaces by given instance ID
+func GetInstanceInterfaces(conf VPC, instanceID string) ([]DescribeInterfacesNetworkInterface, error) {
+	c, err := NewClient(conf)
+	if err != nil {
+		return nil, err
+	}
+	return c.GetInstanceInterfaces(context.Background(), instanceID)
+}
+
+// AssignIP will invoke VPC API to assign an IP to given interface
+func AssignIP(conf VPC, interfaceID string) error {
+	c, err := NewClient(conf)
+	if err != nil {
+		return err
+	}
+	_, _, err = c.AssignIP(context.Background(), interfaceID)
+	return err
+}
+
+// ReleaseIP will invoke VPC API to release IP on given interface
+func ReleaseIP(conf VPC, interfaceID, podIP string) error {
+	c, err := NewClient(conf)
+	if err != nil {
+		return err
+	}
+	return c.ReleaseIP(context.Background(), interfaceID, podIP)
+}
+
+// CheckMigrateIPStatus checks whether given pod IP has been migrated from old interface to new interface
+func CheckMigrateIPStatus(conf VPC, podIP, oldInterfaceID, newInterfaceID string) error {
+	c, err := NewClient(conf)
+	if err != nil {
+		return err
+	}
+	return c.CheckMigrateIPStatus(context.Background(), podIP, oldInterfaceID, newInterfaceID)
+}
+
+// MigrateIP will invoke VPC API to migrate IP from old interface to new interface
+func MigrateIP(conf VPC, ip, oldInterfaceID, newInterfaceID string) error {
+	c, err := NewClient(conf)
+	if err != nil {
+		return err
+	}
+	return c.MigrateIP(context.Background(), ip, oldInterfaceID, newInterfaceID)
+}
@@ -0,0 +1,407 @@
+package vpcapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/von1994/vpcapi/metadata"
+)
+
+const (
+	// CredentialTypeStatic uses secretID and secretKey in vpc config, it's the default type
+	CredentialTypeStatic = "static"
+	// CredentialTypeEnv reads credential from environment variables EnvSecretID, EnvSecretKey and EnvSessionToken
+	CredentialTypeEnv = "env"
+	// CredentialTypeFile reads credential from a JSON file, which is reloaded once changed
+	CredentialTypeFile = "file"
+	// CredentialTypeSTS assumes a CAM role by STS AssumeRole, and uses the temporary credential
+	CredentialTypeSTS = "sts"
+	// CredentialTypeCAMRole uses temporary credential of CAM role bound to the local instance, got from metadata service
+	CredentialTypeCAMRole = "camRole"
+
+	// EnvSecretID is environment variable of secret ID for CredentialTypeEnv
+	EnvSecretID = "TENCENTCLOUD_SECRET_ID"
+	// EnvSecretKey is environment variable of secret key for CredentialTypeEnv
+	EnvSecretKey = "TENCENTCLOUD_SECRET_KEY"
+	// EnvSessionToken is environment variable of session token for CredentialTypeEnv, only for temporary credential
+	EnvSessionToken = "TENCENTCLOUD_SESSION_TOKEN"
+
+	defaultSTSEndpoint         = "sts.tencentcloudapi.com"
+	defaultSTSDurationSeconds  = 7200
+	defaultRoleSessionName     = "vpcapi"
+	defaultCredentialRefresh   = 5 * time.Minute
+	defaultCredentialFetchTime = 10 * time.Second
+)
+
+// Credential is used to sign requests, Token is set for temporary credential
+type Credential struct {
+	SecretID  string `json:"secretID"`
+	SecretKey string `json:"secretKey"`
+	Token     string `json:"token,omitempty"`
+	// Expiration is when temporary credential expires, zero for permanent credential
+	Expiration time.Time `json:"expiration"`
+}
+
+// CredentialProvider provides credential for signers. It's called for every request, so implementations should cache
+// credential if it's expensive to get, and must be safe for concurrent use.
+type CredentialProvider interface {
+	Credential() (*Credential, error)
+}
+
+// ContextCredentialProvider is implemented by providers which may get credential from network, so callers can give up
+// waiting for credential when ctx is done
+type ContextCredentialProvider interface {
+	CredentialProvider
+	CredentialContext(ctx context.Context) (*Credential, error)
+}
+
+// CredentialsConfig defines where to get credential, secretID and secretKey in vpc config are used if not set
+type CredentialsConfig struct {
+	// Type is one of CredentialTypeStatic, CredentialTypeEnv, CredentialTypeFile, CredentialTypeSTS and
+	// CredentialTypeCAMRole
+	Type string `json:"type,omitempty"`
+	// File is path of credential file for CredentialTypeFile, in JSON like {"secretID": "", "secretKey": ""}
+	File string `json:"file,omitempty"`
+	// RoleArn is the role to assume for CredentialTypeSTS. The role is assumed with secretID and secretKey in vpc
+	// config, or with credential in environment variables if they are not set.
+	RoleArn         string `json:"roleArn,omitempty"`
+	RoleSessionName string `json:"roleSessionName,omitempty"`
+	DurationSeconds int    `json:"durationSeconds,omitempty"`
+	// STSEndpoint is endpoint of STS API, default to sts.tencentcloudapi.com
+	STSEndpoint string `json:"stsEndpoint,omitempty"`
+	// RoleName is CAM role bound to the local instance for CredentialTypeCAMRole, the first role listed by metadata
+	// service is used if not set
+	RoleName string `json:"roleName,omitempty"`
+	// RefreshBefore is seconds to refresh temporary credential before it expires, default to 300
+	RefreshBefore int `json:"refreshBefore,omitempty"`
+}
+
+// StaticCredentialProvider always provides the same credential
+type StaticCredentialProvider struct {
+	Cred Credential
+}
+
+// Credential implements CredentialProvider
+func (p *StaticCredentialProvider) Credential() (*Credential, error) {
+	cred := p.Cred
+	return &cred, nil
+}
+
+// EnvCredentialProvider provides credential in environment variables EnvSecretID, EnvSecretKey and EnvSessionToken,
+// they are read for every request, so changes take effect immediately
+type EnvCredentialProvider struct{}
+
+// Credential implements CredentialProvider
+func (p *EnvCredentialProvider) Credential() (*Credential, error) {
+	cred := &Credential{
+		SecretID:  os.Getenv(EnvSecretID),
+		SecretKey: os.Getenv(EnvSecretKey),
+		Token:     os.Getenv(EnvSessionToken),
+	}
+	if cred.SecretID == "" || cred.SecretKey == "" {
+		return nil, fmt.Errorf("VPC.API: environment variable %s or %s is not set", EnvSecretID, EnvSecretKey)
+	}
+	return cred, nil
+}
+
+// FileCredentialProvider provides credential in a JSON file, like {"secretID": "", "secretKey": "", "token": ""}.
+// The file is reloaded once its modification time or size changes, so credential can be rotated without restart.
+type FileCredentialProvider struct {
+	path string
+
+	mutex   sync.Mutex
+	modTime time.Time
+	size    int64
+	cred    *Credential
+}
+
+// NewFileCredentialProvider creates a FileCredentialProvider with given file path
+func NewFileCredentialProvider(path string) *FileCredentialProvider {
+	return &FileCredentialProvider{path: path}
+}
+
+// Credential implements CredentialProvider
+func (p *FileCredentialProvider) Credential() (*Credential, error) {
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return nil, fmt.Errorf("VPC.API: failed to stat credential file %s, since: %v", p.path, err)
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.cred == nil || !info.ModTime().Equal(p.modTime) || info.Size() != p.size {
+		data, err := ioutil.ReadFile(p.path)
+		if err != nil {
+			return nil, fmt.Errorf("VPC.API: failed to read credential file %s, since: %v", p.path, err)
+		}
+		cred := &Credential{}
+		if err := json.Unmarshal(data, cred); err != nil {
+			return nil, fmt.Errorf("VPC.API: failed to parse credential file %s, since: %v", p.path, err)
+		}
+		if cred.SecretID == "" || cred.SecretKey == "" {
+			return nil, fmt.Errorf("VPC.API: secretID or secretKey is not set in credential file %s", p.path)
+		}
+		p.cred, p.modTime, p.size = cred, info.ModTime(), info.Size()
+	}
+	cred := *p.cred
+	return &cred, nil
+}
+
+// refreshingCredentialProvider caches temporary credential got by fetch, and fetches a new one in background before it
+// expires, the cached one is used while refreshing. If refresh fails while the cached one is still valid, the cached
+// one is used, and refresh is tried again next time. Callers wait for refresh only if no valid credential is cached.
+type refreshingCredentialProvider struct {
+	fetch         func(ctx context.Context) (*Credential, error)
+	clock         Clock
+	refreshBefore time.Duration
+
+	mutex sync.Mutex
+	cred  *Credential
+	// err is error of the last refresh, refreshing is closed when the running refresh is done
+	err        error
+	refreshing chan struct{}
+}
+
+func newRefreshingCredentialProvider(fetch func(ctx context.Context) (*Credential, error), clock Clock, refreshBefore time.Duration) *refreshingCredentialProvider {
+	if refreshBefore <= 0 {
+		refreshBefore = defaultCredentialRefresh
+	}
+	return &refreshingCredentialProvider{fetch: fetch, clock: clock, refreshBefore: refreshBefore}
+}
+
+// Credential implements CredentialProvider
+func (p *refreshingCredentialProvider) Credential() (*Credential, error) {
+	return p.CredentialContext(context.Background())
+}
+
+// CredentialContext implements ContextCredentialProvider
+func (p *refreshingCredentialProvider) CredentialContext(ctx context.Context) (*Credential, error) {
+	p.mutex.Lock()
+	now := p.clock.Now()
+	if p.cred != nil && (p.cred.Expiration.IsZero() || now.Add(p.refreshBefore).Before(p.cred.Expiration)) {
+		cred := *p.cred
+		p.mutex.Unlock()
+		return &cred, nil
+	}
+	if p.refreshing == nil {
+		p.refreshing = make(chan struct{})
+		go p.refresh(p.refreshing)
+	}
+	refreshing := p.refreshing
+	if p.cred != nil && now.Before(p.cred.Expiration) {
+		cred := *p.cred
+		p.mutex.Unlock()
+		return &cred, nil
+	}
+	p.mutex.Unlock()
+
+	select {
+	case <-refreshing:
+	case <-ctx.Done():
+		return nil, fmt.Errorf("VPC.API: failed to wait for credential refresh, since: %w", ctx.Err())
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.cred != nil && (p.cred.Expiration.IsZero() || p.clock.Now().Before(p.cred.Expiration)) {
+		cred := *p.cred
+		return &cred, nil
+	}
+	return nil, p.err
+}
+
+// refresh fetches credential with timeout of its own, so it isn't canceled by the caller who starts it
+func (p *refreshingCredentialProvider) refresh(done chan struct{}) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultCredentialFetchTime)
+	defer cancel()
+	cred, err := p.fetch(ctx)
+	p.mutex.Lock()
+	if err == nil {
+		p.cred = cred
+	}
+	p.err = err
+	p.refreshing = nil
+	p.mutex.Unlock()
+	close(done)
+}
+
+// stsAssumeRoleResponse is response of sts request AssumeRole
+type stsAssumeRoleResponse struct {
+	Response struct {
+		Credentials struct {
+			Token        string `json:"Token"`
+			TmpSecretID  string `json:"TmpSecretId"`
+			TmpSecretKey string `json:"TmpSecretKey"`
+		} `json:"Credentials"`
+		ExpiredTime int64  `json:"ExpiredTime"`
+		RequestID   string `json:"RequestId"`
+	} `json:"Response"`
+}
+
+// NewSTSCredentialProvider creates a CredentialProvider, which assumes given role by STS AssumeRole with source
+// credential, and refreshes the temporary credential before it expires
+func NewSTSCredentialProvider(source CredentialProvider, conf CredentialsConfig, region string, httpClient *http.Client) CredentialProvider {
+	return newSTSCredentialProvider(source, conf, region, httpClient, 0, realClock{})
+}
+
+func newSTSCredentialProvider(source CredentialProvider, conf CredentialsConfig, region string, httpClient *http.Client,
+	maxBodySize int64, clock Clock) CredentialProvider {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	endpoint := conf.STSEndpoint
+	if endpoint == "" {
+		endpoint = defaultSTSEndpoint
+	}
+	sessionName := conf.RoleSessionName
+	if sessionName == "" {
+		sessionName = defaultRoleSessionName
+	}
+	duration := conf.DurationSeconds
+	if duration <= 0 {
+		duration = defaultSTSDurationSeconds
+	}
+	signer := &TC3Signer{Credentials: source, Region: region, Clock: clock}
+	fetch := func(ctx context.Context) (*Credential, error) {
+		params := map[string]string{
+			"Action":          "AssumeRole",
+			"Version":         "2018-08-13",
+			"Service":         "sts",
+			"RoleArn":         conf.RoleArn,
+			"RoleSessionName": sessionName,
+			"DurationSeconds": strconv.Itoa(duration),
+		}
+		req, err := signer.SignContext(ctx, endpoint, params)
+		if err != nil {
+			return nil, fmt.Errorf("VPC.API: failed to sign AssumeRole request, since: %v", err)
+		}
+		resp, err := httpClient.Do(req.WithContext(ctx))
+		if err != nil {
+			return nil, fmt.Errorf("VPC.API: AssumeRole doRequest failed with: %w", err)
+		}
+		defer resp.Body.Close()
+		body, err := readResponseBody(resp.Body, "AssumeRole", maxBodySize)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkResponse("AssumeRole", resp.StatusCode, body); err != nil {
+			return nil, err
+		}
+		assumeResp := &stsAssumeRoleResponse{}
+		if err := json.Unmarshal(body, assumeResp); err != nil {
+			return nil, fmt.Errorf("VPC.API: AssumeRole failed to do json unmarshal, since: %v", err)
+		}
+		if assumeResp.Response.ExpiredTime <= 0 {
+			return nil, fmt.Errorf("VPC.API: no expired time in response of AssumeRole %s", assumeResp.Response.RequestID)
+		}
+		return &Credential{
+			SecretID:   assumeResp.Response.Credentials.TmpSecretID,
+			SecretKey:  assumeResp.Response.Credentials.TmpSecretKey,
+			Token:      assumeResp.Response.Credentials.Token,
+			Expiration: time.Unix(assumeResp.Response.ExpiredTime, 0),
+		}, nil
+	}
+	return newRefreshingCredentialProvider(fetch, clock, time.Duration(conf.RefreshBefore)*time.Second)
+}
+
+// NewCAMRoleCredentialProvider creates a CredentialProvider, which gets temporary credential of CAM role bound to the
+// local instance from metadata service, and refreshes it before it expires. The first role listed by metadata service
+// is used if roleName is empty.
+func NewCAMRoleCredentialProvider(metadataClient *metadata.Client, roleName string, refreshBefore time.Duration) CredentialProvider {
+	return newCAMRoleCredentialProvider(metadataClient, roleName, refreshBefore, realClock{})
+}
+
+func newCAMRoleCredentialProvider(metadataClient *metadata.Client, roleName string, refreshBefore time.Duration, clock Clock) CredentialProvider {
+	fetch := func(ctx context.Context) (*Credential, error) {
+		role := roleName
+		if role == "" {
+			roles, err := metadataClient.CAMRoles(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("VPC.API: failed to get CAM role of the local instance, since: %w", err)
+			}
+			if len(roles) == 0 {
+				return nil, fmt.Errorf("VPC.API: no CAM role is bound to the local instance")
+			}
+			role = roles[0]
+		}
+		roleCred, err := metadataClient.CAMRoleCredentials(ctx, role)
+		if err != nil {
+			return nil, fmt.Errorf("VPC.API: failed to get credential of CAM role %s, since: %w", role, err)
+		}
+		// temporary credential always expires, zero expired time would make it look expired and refreshed forever
+		if roleCred.ExpiredTime <= 0 {
+			return nil, fmt.Errorf("VPC.API: no expired time in credential of CAM role %s", role)
+		}
+		return &Credential{
+			SecretID:   roleCred.TmpSecretID,
+			SecretKey:  roleCred.TmpSecretKey,
+			Token:      roleCred.Token,
+			Expiration: time.Unix(roleCred.ExpiredTime, 0),
+		}, nil
+	}
+	return newRefreshingCredentialProvider(fetch, clock, refreshBefore)
+}
+
+// NewCredentialProvider creates a CredentialProvider based on credentials in given vpc config, secretID and secretKey
+// in config are used if credentials is not set. Default http client and metadata client are used if they are nil.
+func NewCredentialProvider(conf VPC, httpClient *http.Client, metadataClient *metadata.Client) (CredentialProvider, error) {
+	return newCredentialProvider(conf, httpClient, metadataClient, realClock{})
+}
+
+func newCredentialProvider(conf VPC, httpClient *http.Client, metadataClient *metadata.Client, clock Clock) (CredentialProvider, error) {
+	static := &StaticCredentialProvider{Cred: Credential{SecretID: conf.SecretID, SecretKey: conf.SecretKey}}
+	if conf.Credentials == nil {
+		return static, nil
+	}
+	switch conf.Credentials.Type {
+	case "", CredentialTypeStatic:
+		return static, nil
+	case CredentialTypeEnv:
+		return &EnvCredentialProvider{}, nil
+	case CredentialTypeFile:
+		if conf.Credentials.File == "" {
+			return nil, fmt.Errorf("VPC.API: file is required by credential type %s", CredentialTypeFile)
+		}
+		return NewFileCredentialProvider(conf.Credentials.File), nil
+	case CredentialTypeSTS:
+		if conf.Credentials.RoleArn == "" {
+			return nil, fmt.Errorf("VPC.API: roleArn is required by credential type %s", CredentialTypeSTS)
+		}
+		var source CredentialProvider = static
+		if conf.SecretID == "" {
+			source = &EnvCredentialProvider{}
+		}
+		return newSTSCredentialProvider(source, *conf.Credentials, conf.Region, httpClient, conf.MaxResponseBodySize, clock), nil
+	case CredentialTypeCAMRole:
+		if metadataClient == nil {
+			metadataClient = metadata.NewClient(conf.MetadataEndpoint, nil)
+		}
+		refreshBefore := time.Duration(conf.Credentials.RefreshBefore) * time.Second
+		return newCAMRoleCredentialProvider(metadataClient, conf.Credentials.RoleName, refreshBefore, clock), nil
+	default:
+		return nil, fmt.Errorf("VPC.API: unsupported credential type %s", conf.Credentials.Type)
+	}
+}
+
+// getCredential returns credential from provider, or credential with given secret ID and key if provider is nil
+func getCredential(ctx context.Context, provider CredentialProvider, secretID, secretKey string) (*Credential, error) {
+	if provider == nil {
+		return &Credential{SecretID: secretID, SecretKey: secretKey}, nil
+	}
+	var cred *Credential
+	var err error
+	if ctxProvider, ok := provider.(ContextCredentialProvider); ok {
+		cred, err = ctxProvider.CredentialContext(ctx)
+	} else {
+		cred, err = provider.Credential()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("VPC.API: failed to get credential, since: %w", err)
+	}
+	return cred, nil
+}
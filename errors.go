@@ -0,0 +1,186 @@
+package vpcapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// resourceBusyMessage is the message returned by v2 API when the resource is being operated by another request
+	resourceBusyMessage = "资源正在执行其他操作"
+	// maxErrorBodySize is the max size of body kept in HTTPStatusError
+	maxErrorBodySize = 256
+)
+
+// APIError stands for a failure reported by cloud API. For v2 API, Code and CodeDesc come from "code" and "codeDesc"
+// in response; for API 3.0, Code is always 0 and CodeDesc comes from "Response.Error.Code".
+type APIError struct {
+	Action     string
+	Code       int
+	CodeDesc   string
+	Message    string
+	RequestID  string
+	HTTPStatus int
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("VPC.API: %s failed, code %d, codeDesc %s, message %s, requestID %s, http status %d",
+		e.Action, e.Code, e.CodeDesc, e.Message, e.RequestID, e.HTTPStatus)
+}
+
+// TimeoutError is returned when request to cloud API isn't done in time, including connecting, waiting for response
+// and reading response body
+type TimeoutError struct {
+	Action  string
+	Timeout time.Duration
+	Err     error
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("VPC.API: %s timed out after %v, since: %v", e.Action, e.Timeout, e.Err)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// HTTPStatusError is returned when cloud API responds non-2xx status without error details in body, like failures
+// of proxies or gateways. Body is truncated to maxErrorBodySize.
+type HTTPStatusError struct {
+	Action     string
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("VPC.API: %s failed with http status %d, body %q", e.Action, e.StatusCode, e.Body)
+}
+
+// IsTimeout tells whether err is caused by request to cloud API timed out
+func IsTimeout(err error) bool {
+	timeoutErr := &TimeoutError{}
+	return errors.As(err, &timeoutErr)
+}
+
+// NotFoundError is returned when the resource queried, like instance or interface, doesn't exist
+type NotFoundError struct {
+	Resource string
+	Key      string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("VPC.API: %s %s not found", e.Resource, e.Key)
+}
+
+// AmbiguousError is returned when more than one resource matches the key, while only one is expected
+type AmbiguousError struct {
+	Resource string
+	Key      string
+	Matches  []string
+}
+
+func (e *AmbiguousError) Error() string {
+	return fmt.Sprintf("VPC.API: %s %s is ambiguous, matches %v", e.Resource, e.Key, e.Matches)
+}
+
+// apiResponseStatus contains fields in response of both v2 API and API 3.0 to tell whether request succeeded
+type apiResponseStatus struct {
+	Code      int    `json:"code"`
+	CodeDesc  string `json:"codeDesc"`
+	Message   string `json:"message"`
+	RequestID string `json:"requestId"`
+	Response  *struct {
+		Error *struct {
+			Code    string `json:"Code"`
+			Message string `json:"Message"`
+		} `json:"Error"`
+		RequestID string `json:"RequestId"`
+	} `json:"Response"`
+}
+
+// checkResponse returns *APIError if response body reports a failure, body can't be parsed is left to callers
+func checkResponse(action string, httpStatus int, body []byte) error {
+	status := &apiResponseStatus{}
+	if err := json.Unmarshal(body, status); err != nil {
+		return nil
+	}
+	if status.Response != nil {
+		if status.Response.Error == nil {
+			return nil
+		}
+		return &APIError{
+			Action:     action,
+			CodeDesc:   status.Response.Error.Code,
+			Message:    status.Response.Error.Message,
+			RequestID:  status.Response.RequestID,
+			HTTPStatus: httpStatus,
+		}
+	}
+	if status.Code == 0 {
+		return nil
+	}
+	return &APIError{
+		Action:     action,
+		Code:       status.Code,
+		CodeDesc:   status.CodeDesc,
+		Message:    status.Message,
+		RequestID:  status.RequestID,
+		HTTPStatus: httpStatus,
+	}
+}
+
+func asAPIError(err error) (*APIError, bool) {
+	apiErr := &APIError{}
+	if errors.As(err, &apiErr) {
+		return apiErr, true
+	}
+	return nil, false
+}
+
+// IsResourceBusy tells whether err is caused by the resource is being operated by another request
+func IsResourceBusy(err error) bool {
+	apiErr, ok := asAPIError(err)
+	if !ok {
+		return false
+	}
+	return strings.Contains(apiErr.CodeDesc, "MutexOperation") ||
+		strings.Contains(apiErr.CodeDesc, "TaskRunning") ||
+		strings.Contains(apiErr.Message, resourceBusyMessage)
+}
+
+// IsQuotaExceeded tells whether err is caused by reaching quota, like max IPs on an interface
+func IsQuotaExceeded(err error) bool {
+	apiErr, ok := asAPIError(err)
+	if !ok {
+		return false
+	}
+	return strings.HasPrefix(apiErr.CodeDesc, "LimitExceeded") ||
+		strings.Contains(apiErr.CodeDesc, "QuotaExceeded")
+}
+
+// IsNotFound tells whether err is caused by the resource, like interface or IP, doesn't exist
+func IsNotFound(err error) bool {
+	notFoundErr := &NotFoundError{}
+	if errors.As(err, &notFoundErr) {
+		return true
+	}
+	apiErr, ok := asAPIError(err)
+	if !ok {
+		return false
+	}
+	return strings.Contains(apiErr.CodeDesc, "NotFound")
+}
+
+// isFilterUnsupported tells whether err is caused by API doesn't support filters in request
+func isFilterUnsupported(err error) bool {
+	apiErr, ok := asAPIError(err)
+	if !ok {
+		return false
+	}
+	return strings.Contains(apiErr.CodeDesc, "UnknownParameter") ||
+		strings.Contains(apiErr.CodeDesc, "InvalidFilter") ||
+		strings.Contains(apiErr.CodeDesc, "Filter.NotSupported")
+}
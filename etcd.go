@@ -30,11 +30,14 @@ type Etcdv3Client struct {
 	Client *clientv3.Client
 }
 
-// PodInfo defines struct pod info about vpc
+// PodInfo defines struct pod info about vpc, IPv6 is set for dual-stack pods, SecurityGroups records security groups
+// applied to interface of pod by AnnoKeyVPCSecurityGroups
 type PodInfo struct {
-	IP          string `json:"ip"`
-	InterfaceID string `json:"interfaceID"`
-	IPRetain    string `json:"ipRetain"`
+	IP             string   `json:"ip"`
+	IPv6           string   `json:"ipv6,omitempty"`
+	InterfaceID    string   `json:"interfaceID"`
+	IPRetain       string   `json:"ipRetain"`
+	SecurityGroups []string `json:"securityGroups,omitempty"`
 }
 
 // IPInfo defines struct ip info on vpc
@@ -45,6 +48,11 @@ type IPInfo struct {
 
 // NewEtcdv3Client create a new etcdv3 client based on given netconf
 func NewEtcdv3Client(caCertFile, certFile, keyFile, etcdEndpoints string) (*Etcdv3Client, error) {
+	return NewEtcdv3ClientContext(context.Background(), caCertFile, certFile, keyFile, etcdEndpoints)
+}
+
+// NewEtcdv3ClientContext is like NewEtcdv3Client, but connectivity test will be aborted once ctx is done
+func NewEtcdv3ClientContext(ctx context.Context, caCertFile, certFile, keyFile, etcdEndpoints string) (*Etcdv3Client, error) {
 	etcdLocation := strings.Split(etcdEndpoints, ",")
 	if len(etcdLocation) == 0 {
 		return nil, fmt.Errorf("no etcd endpoints specified")
@@ -71,20 +79,26 @@ func NewEtcdv3Client(caCertFile, certFile, keyFile, etcdEndpoints string) (*Etcd
 	}
 
 	// test clientv3 connectivity
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
 	defer cancel()
 	ops := []clientv3.OpOption{
 		clientv3.WithPrefix(),
 		clientv3.WithLimit(1),
 	}
 	if _, err := client.Get(ctx, "/", ops...); err != nil {
+		client.Close()
 		return nil, err
 	}
 
 	return &Etcdv3Client{Client: client}, nil
 }
 
+// getIPKey returns key of IP info, IP is formatted in canonical form, so different forms of an IPv6 address share the
+// same key
 func getIPKey(ip string) string {
+	if parsed := net.ParseIP(ip); parsed != nil {
+		ip = parsed.String()
+	}
 	return fmt.Sprintf("%s%s", ETCDV3VPCIPKEYPREFIX, ip)
 }
 
@@ -94,7 +108,12 @@ func getPodKey(namespace, name string) string {
 
 // GetPodInfo get pod info with by given namespace and pod name
 func (c *Etcdv3Client) GetPodInfo(namespace, name string) (*PodInfo, error) {
-	resp, err := c.Client.Get(context.Background(), getPodKey(namespace, name))
+	return c.GetPodInfoContext(context.Background(), namespace, name)
+}
+
+// GetPodInfoContext is like GetPodInfo, but with given ctx
+func (c *Etcdv3Client) GetPodInfoContext(ctx context.Context, namespace, name string) (*PodInfo, error) {
+	resp, err := c.Client.Get(ctx, getPodKey(namespace, name))
 	if err != nil {
 		return nil, err
 	}
@@ -108,12 +127,12 @@ func (c *Etcdv3Client) GetPodInfo(namespace, name string) (*PodInfo, error) {
 	return pod, nil
 }
 
-func (c *Etcdv3Client) _put(key string, data []byte, override bool) ([]byte, error) {
+func (c *Etcdv3Client) _put(ctx context.Context, key string, data []byte, override bool) ([]byte, error) {
 	ops := []clientv3.Op{clientv3.OpGet(key)}
 	if override {
 		ops = append(ops, clientv3.OpPut(key, string(data)))
 	}
-	resp, err := c.Client.Txn(context.Background()).If(
+	resp, err := c.Client.Txn(ctx).If(
 		clientv3.Compare(clientv3.Version(key), "=", 0)).Then(
 		clientv3.OpPut(key, string(data))).Else(ops...).Commit()
 	if err != nil {
@@ -128,51 +147,95 @@ func (c *Etcdv3Client) _put(key string, data []byte, override bool) ([]byte, err
 // PutPodInfo will put pod info into etcd by given namespace, pod name and IP, interfaceID on which interface IP is,
 // and whether IP is retained
 func (c *Etcdv3Client) PutPodInfo(namespace, name, ip, interfaceID, ipRetain string) (string, string, error) {
+	return c.PutPodInfoContext(context.Background(), namespace, name, ip, interfaceID, ipRetain)
+}
+
+// PutPodInfoContext is like PutPodInfo, but with given ctx
+func (c *Etcdv3Client) PutPodInfoContext(ctx context.Context, namespace, name, ip, interfaceID, ipRetain string) (string, string, error) {
+	respPod, err := c.PutDualStackPodInfoContext(ctx, namespace, name, &PodInfo{IP: ip, InterfaceID: interfaceID, IPRetain: ipRetain})
+	if err != nil || respPod == nil {
+		return "", "", err
+	}
+	return respPod.IP, respPod.InterfaceID, nil
+}
+
+// PutDualStackPodInfo will put given pod info, which may contain both IPv4 and IPv6 address and applied security
+// groups, into etcd by given namespace and pod name, the previous pod info is returned if there is
+func (c *Etcdv3Client) PutDualStackPodInfo(namespace, name string, pod *PodInfo) (*PodInfo, error) {
+	return c.PutDualStackPodInfoContext(context.Background(), namespace, name, pod)
+}
+
+// PutDualStackPodInfoContext is like PutDualStackPodInfo, but with given ctx
+func (c *Etcdv3Client) PutDualStackPodInfoContext(ctx context.Context, namespace, name string, pod *PodInfo) (*PodInfo, error) {
 	key := getPodKey(namespace, name)
-	pod := &PodInfo{IP: ip, InterfaceID: interfaceID, IPRetain: ipRetain}
 	data, err := json.Marshal(pod)
 	if err != nil {
-		return "", "", fmt.Errorf("Failed to marshal data for pod %s.%s, since: %v", namespace, name, err)
+		return nil, fmt.Errorf("Failed to marshal data for pod %s.%s, since: %v", namespace, name, err)
 	}
-	resp, err := c._put(key, data, true)
+	resp, err := c._put(ctx, key, data, true)
 	if err != nil {
-		return "", "", fmt.Errorf("Failed to do etcdv3 txn for pod %s.%s, since: %v", namespace, name, err)
+		return nil, fmt.Errorf("Failed to do etcdv3 txn for pod %s.%s, since: %v", namespace, name, err)
 	}
 	if resp != nil {
 		respPod := &PodInfo{}
 		if err := json.Unmarshal(resp, respPod); err != nil {
-			return "", "", fmt.Errorf("Failed to unmarshal etcdv3 get response, since: %v", err)
+			return nil, fmt.Errorf("Failed to unmarshal etcdv3 get response, since: %v", err)
 		}
-		return respPod.IP, respPod.InterfaceID, nil
+		return respPod, nil
 	}
-	return "", "", nil
+	return nil, nil
 }
 
 // DeletePodIPInfo delete both pod and IP info by given namespace, pod name and ip
 func (c *Etcdv3Client) DeletePodIPInfo(namespace, name, ip string) error {
-	ops := []clientv3.Op{
-		clientv3.OpDelete(getPodKey(namespace, name)),
-		clientv3.OpDelete(getIPKey(ip)),
+	return c.DeletePodIPInfoContext(context.Background(), namespace, name, ip)
+}
+
+// DeletePodIPInfoContext is like DeletePodIPInfo, but with given ctx
+func (c *Etcdv3Client) DeletePodIPInfoContext(ctx context.Context, namespace, name, ip string) error {
+	return c.DeletePodIPsInfoContext(ctx, namespace, name, []string{ip})
+}
+
+// DeletePodIPsInfo delete pod info and info of all given IPs, like both IPv4 and IPv6 address of a dual-stack pod
+func (c *Etcdv3Client) DeletePodIPsInfo(namespace, name string, ips []string) error {
+	return c.DeletePodIPsInfoContext(context.Background(), namespace, name, ips)
+}
+
+// DeletePodIPsInfoContext is like DeletePodIPsInfo, but with given ctx
+func (c *Etcdv3Client) DeletePodIPsInfoContext(ctx context.Context, namespace, name string, ips []string) error {
+	ops := []clientv3.Op{clientv3.OpDelete(getPodKey(namespace, name))}
+	for _, ip := range ips {
+		ops = append(ops, clientv3.OpDelete(getIPKey(ip)))
 	}
-	_, err := c.Client.Txn(context.Background()).Then(ops...).Commit()
+	_, err := c.Client.Txn(ctx).Then(ops...).Commit()
 	return err
 }
 
 // DeleteIPInfo deletes IP info from etcd
 func (c *Etcdv3Client) DeleteIPInfo(ip string) error {
-	_, err := c.Client.Delete(context.Background(), getIPKey(ip))
+	return c.DeleteIPInfoContext(context.Background(), ip)
+}
+
+// DeleteIPInfoContext is like DeleteIPInfo, but with given ctx
+func (c *Etcdv3Client) DeleteIPInfoContext(ctx context.Context, ip string) error {
+	_, err := c.Client.Delete(ctx, getIPKey(ip))
 	return err
 }
 
 // PutIPInfo will put IP info into etcd based on given namespace, pod name and IP
 func (c *Etcdv3Client) PutIPInfo(namespace, name, ip string) (string, string, error) {
+	return c.PutIPInfoContext(context.Background(), namespace, name, ip)
+}
+
+// PutIPInfoContext is like PutIPInfo, but with given ctx
+func (c *Etcdv3Client) PutIPInfoContext(ctx context.Context, namespace, name, ip string) (string, string, error) {
 	key := getIPKey(ip)
 	info := &IPInfo{Namespace: namespace, Name: name}
 	data, err := json.Marshal(info)
 	if err != nil {
 		return "", "", fmt.Errorf("Failed to marshal data for ip %s: since: %v", ip, err)
 	}
-	resp, err := c._put(key, data, false)
+	resp, err := c._put(ctx, key, data, false)
 	if err != nil {
 		return "", "", fmt.Errorf("Failed to do etcdv3 txn for ip %s, since: %v", ip, err)
 	}
@@ -188,10 +251,37 @@ func (c *Etcdv3Client) PutIPInfo(namespace, name, ip string) (string, string, er
 
 // ValidateAndRecordIP will validate IP, and try to put IP info into etcd, with IP as key, owner(namespace and name) as value
 func (c *Etcdv3Client) ValidateAndRecordIP(namespace, name, ip string) (bool, error) {
+	return c.ValidateAndRecordIPContext(context.Background(), namespace, name, ip)
+}
+
+// ValidateAndRecordIPContext is like ValidateAndRecordIP, but with given ctx
+func (c *Etcdv3Client) ValidateAndRecordIPContext(ctx context.Context, namespace, name, ip string) (bool, error) {
 	if net.ParseIP(ip) == nil {
 		return false, fmt.Errorf("Invalide IP %s for pod", ip)
 	}
-	ownerNamespace, ownerName, err := c.PutIPInfo(namespace, name, ip)
+	return c.recordIP(ctx, namespace, name, ip)
+}
+
+// ValidateAndRecordIPFamily is like ValidateAndRecordIP, but IP must be of given family
+func (c *Etcdv3Client) ValidateAndRecordIPFamily(namespace, name, ip string, family IPFamily) (bool, error) {
+	return c.ValidateAndRecordIPFamilyContext(context.Background(), namespace, name, ip, family)
+}
+
+// ValidateAndRecordIPFamilyContext is like ValidateAndRecordIPFamily, but with given ctx
+func (c *Etcdv3Client) ValidateAndRecordIPFamilyContext(ctx context.Context, namespace, name, ip string, family IPFamily) (bool, error) {
+	ipFamily, err := GetIPFamily(ip)
+	if err != nil {
+		return false, fmt.Errorf("Invalide IP %s for pod", ip)
+	}
+	if ipFamily != family {
+		return false, fmt.Errorf("Invalide IP %s for pod, since: it's %s rather than %s", ip, ipFamily, family)
+	}
+	return c.recordIP(ctx, namespace, name, ip)
+}
+
+// recordIP puts IP info into etcd, returns false if IP is owned by another pod
+func (c *Etcdv3Client) recordIP(ctx context.Context, namespace, name, ip string) (bool, error) {
+	ownerNamespace, ownerName, err := c.PutIPInfoContext(ctx, namespace, name, ip)
 	if err != nil {
 		return false, fmt.Errorf("Failed to registry VPC IP info into etcd, since: %v", err)
 	}
@@ -0,0 +1,109 @@
+package vpcapi
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/coreos/etcd/clientv3/concurrency"
+)
+
+const (
+	// ETCDV3VPCINTERFACELOCKPREFIX is key prefix for vpc cni to lock network interfaces in etcd
+	ETCDV3VPCINTERFACELOCKPREFIX = "/vpc/locks/interfaces/"
+
+	defaultInterfaceLockTTL = 60
+)
+
+// EtcdInterfaceLocker is an InterfaceLocker serializing operations on interfaces across processes and nodes with
+// etcd mutex. Locks are bound to a session lease, so they are released if the process dies. Since locks of the same
+// session can't exclude each other, it must be used with Client, which serializes callers in-process at first.
+type EtcdInterfaceLocker struct {
+	client *Etcdv3Client
+	ttl    int
+
+	mutex   sync.Mutex
+	session *concurrency.Session
+}
+
+// NewEtcdInterfaceLocker creates an EtcdInterfaceLocker with given etcd client, ttl is seconds of session lease,
+// default to 60
+func (c *Etcdv3Client) NewEtcdInterfaceLocker(ttl int) *EtcdInterfaceLocker {
+	if ttl <= 0 {
+		ttl = defaultInterfaceLockTTL
+	}
+	return &EtcdInterfaceLocker{client: c, ttl: ttl}
+}
+
+// currentSession returns the current session, nil if it's not created yet or expired
+func (l *EtcdInterfaceLocker) currentSession() *concurrency.Session {
+	if l.session == nil {
+		return nil
+	}
+	select {
+	case <-l.session.Done():
+		l.session = nil
+		return nil
+	default:
+		return l.session
+	}
+}
+
+// getSession returns the current session, a new one is created if it's not created yet or expired. Lease of the new
+// session is granted with ctx outside of the mutex, so an unreachable etcd neither blocks callers beyond their
+// deadlines, nor blocks other callers holding the mutex.
+func (l *EtcdInterfaceLocker) getSession(ctx context.Context) (*concurrency.Session, error) {
+	l.mutex.Lock()
+	session := l.currentSession()
+	l.mutex.Unlock()
+	if session != nil {
+		return session, nil
+	}
+	lease, err := l.client.Client.Grant(ctx, int64(l.ttl))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to grant etcdv3 lease, since: %v", err)
+	}
+	// session keeps the lease alive in background, so ctx of caller shouldn't be used by it
+	session, err = concurrency.NewSession(l.client.Client, concurrency.WithTTL(l.ttl), concurrency.WithLease(lease.ID))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create etcdv3 session, since: %v", err)
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if current := l.currentSession(); current != nil {
+		// another caller created a session meanwhile, use it and revoke the lease of ours
+		go session.Close()
+		return current, nil
+	}
+	l.session = session
+	return session, nil
+}
+
+// Lock implements InterfaceLocker
+func (l *EtcdInterfaceLocker) Lock(ctx context.Context, interfaceID string) (func(), error) {
+	session, err := l.getSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+	mutex := concurrency.NewMutex(session, ETCDV3VPCINTERFACELOCKPREFIX+interfaceID)
+	if err := mutex.Lock(ctx); err != nil {
+		return nil, fmt.Errorf("Failed to lock interface %s in etcdv3, since: %v", interfaceID, err)
+	}
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), etcdClientTimeout)
+		defer cancel()
+		mutex.Unlock(ctx)
+	}, nil
+}
+
+// Close closes the session, all locks held are released
+func (l *EtcdInterfaceLocker) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.session == nil {
+		return nil
+	}
+	err := l.session.Close()
+	l.session = nil
+	return err
+}
@@ -0,0 +1,20 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package vpcapi
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+func fileLockSupported() error {
+	return fmt.Errorf("VPC.API: node rate limit is not supported on %s", runtime.GOOS)
+}
+
+func tryLockFile(path string) (*os.File, bool, error) {
+	return nil, false, fileLockSupported()
+}
+
+func unlockFile(file *os.File) {}
@@ -0,0 +1,35 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+// +build linux darwin freebsd netbsd openbsd dragonfly
+
+package vpcapi
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+func fileLockSupported() error {
+	return nil
+}
+
+// tryLockFile opens given file and tries to lock it exclusively without blocking, the file is returned only if it's
+// locked
+func tryLockFile(path string) (*os.File, bool, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, false, fmt.Errorf("VPC.API: failed to open lock file %s, since: %v", path, err)
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		file.Close()
+		if err == syscall.EWOULDBLOCK {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("VPC.API: failed to lock file %s, since: %v", path, err)
+	}
+	return file, true, nil
+}
+
+func unlockFile(file *os.File) {
+	syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+}
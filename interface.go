@@ -0,0 +1,268 @@
+package vpcapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	// TaskStatusSuccess means async task of vpc succeeded
+	TaskStatusSuccess = 0
+	// TaskStatusFailed means async task of vpc failed
+	TaskStatusFailed = 1
+	// TaskStatusRunning means async task of vpc is still running
+	TaskStatusRunning = 2
+
+	defaultTaskRetry    = 60
+	defaultTaskInterval = 1000
+)
+
+// doInterfaceAction invokes given interface action with retry, and waits for async task if any. For actions not
+// idempotent, like creating or attaching interface, done should be given to tell whether an attempt timed out has
+// succeeded on server side before retrying it, it returns ID of the interface if so, and the action won't be invoked
+// again.
+func (c *Client) doInterfaceAction(ctx context.Context, params map[string]string, done func() (string, error)) (*NetworkInterfaceActionResponse, error) {
+	action := params["Action"]
+	policy := c.getRetryPolicy(c.conf.InterfaceOp.Retry, c.conf.InterfaceOp.Interval)
+	actionResp := &NetworkInterfaceActionResponse{}
+	timedOut := false
+	// checkDone returns true if the last attempt timed out but succeeded
+	checkDone := func() (bool, error) {
+		if !timedOut || done == nil {
+			return false, nil
+		}
+		interfaceID, err := done()
+		if err != nil || interfaceID == "" {
+			return false, err
+		}
+		c.logger.Printf("VPC.API: %s timed out but succeeded on interface %s", action, interfaceID)
+		actionResp.Data.NetworkInterfaceID = interfaceID
+		return true, nil
+	}
+	err := c.retry(ctx, policy, func(int) error {
+		if ok, err := checkDone(); ok || err != nil {
+			return err
+		}
+		reqParams := make(map[string]string, len(params))
+		for k, v := range params {
+			reqParams[k] = v
+		}
+		resp, err := c.doRequest(ctx, reqParams)
+		timedOut = IsTimeout(err)
+		if err != nil {
+			return fmt.Errorf("VPC.API: %s doRequest failed with: %w", action, err)
+		}
+		if err := json.Unmarshal(resp, actionResp); err != nil {
+			return fmt.Errorf("VPC.API: %s failed to do json unmarshal, since: %v", action, err)
+		}
+		return nil
+	})
+	if err != nil {
+		if ok, checkErr := checkDone(); !ok || checkErr != nil {
+			return nil, err
+		}
+	}
+	if taskID := actionResp.GetTaskID(); taskID != 0 {
+		if err := c.WaitTask(ctx, taskID); err != nil {
+			return nil, fmt.Errorf("VPC.API: %s task %d failed, since: %w", action, taskID, err)
+		}
+	}
+	return actionResp, nil
+}
+
+// WaitTask polls async task of vpc with interfaceOp task settings, until task is done
+func (c *Client) WaitTask(ctx context.Context, taskID int) error {
+	taskRetry, taskInterval := c.conf.InterfaceOp.TaskRetry, c.conf.InterfaceOp.TaskInterval
+	if taskRetry <= 0 {
+		taskRetry = defaultTaskRetry
+	}
+	if taskInterval <= 0 {
+		taskInterval = defaultTaskInterval
+	}
+	for i := 0; i < taskRetry; i++ {
+		if i > 0 {
+			if err := c.sleep(ctx, time.Duration(taskInterval)*time.Millisecond); err != nil {
+				return err
+			}
+		}
+		params := getBaseParams("DescribeVpcTaskResult", c.conf.VPCID)
+		params["taskId"] = strconv.Itoa(taskID)
+		resp, err := c.doRequest(ctx, params)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			c.logger.Printf("VPC.API: failed to describe task %d, since: %v", taskID, err)
+			continue
+		}
+		taskResp := &DescribeVpcTaskResultResponse{}
+		if err := json.Unmarshal(resp, taskResp); err != nil {
+			return fmt.Errorf("VPC.API: DescribeVpcTaskResult failed to do json unmarshal, since: %v", err)
+		}
+		switch taskResp.Data.Status {
+		case TaskStatusSuccess:
+			return nil
+		case TaskStatusFailed:
+			return fmt.Errorf("VPC.API: task %d failed with output %s", taskID, string(taskResp.Data.Output))
+		}
+	}
+	return fmt.Errorf("VPC.API: after %d * %dms wait, task %d is still running", taskRetry, taskInterval, taskID)
+}
+
+// CreateNetworkInterface creates a network interface with given name in given subnet, and returns the created
+// interface. Name is required, it's used to find the interface created by an attempt timed out, instead of creating
+// a duplicate one by retry.
+func (c *Client) CreateNetworkInterface(ctx context.Context, subnetID, name string) (*DescribeInterfacesNetworkInterface, error) {
+	if name == "" {
+		return nil, fmt.Errorf("VPC.API: name is required to create interface in subnet %s", subnetID)
+	}
+	params := getBaseParams("CreateNetworkInterface", c.conf.VPCID)
+	params["subnetId"] = subnetID
+	params["networkInterfaceName"] = name
+	resp, err := c.doInterfaceAction(ctx, params, func() (string, error) {
+		intf, err := c.findInterfaceByName(ctx, subnetID, name)
+		if err != nil || intf == nil {
+			return "", err
+		}
+		return intf.NetworkInterfaceID, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("VPC.API: failed to create interface %s in subnet %s, since: %w", name, subnetID, err)
+	}
+	interfaceID := resp.Data.NetworkInterfaceID
+	if interfaceID == "" {
+		return nil, fmt.Errorf("VPC.API: no interface ID in response of creating interface %s", name)
+	}
+	intf, err := c.GetInterface(ctx, interfaceID)
+	if err != nil {
+		return nil, err
+	}
+	if intf == nil {
+		return nil, fmt.Errorf("VPC.API: interface %s not found after created", interfaceID)
+	}
+	c.logger.Printf("VPC.API: created interface %v", *intf)
+	return intf, nil
+}
+
+// findInterfaceByName returns the interface with given name in given subnet, nil if not found
+func (c *Client) findInterfaceByName(ctx context.Context, subnetID, name string) (*DescribeInterfacesNetworkInterface, error) {
+	var matched []DescribeInterfacesNetworkInterface
+	filter := InterfaceFilter{SubnetID: subnetID, NetworkInterfaceName: name}
+	err := c.ForEachInterface(ctx, filter, func(intf *DescribeInterfacesNetworkInterface) bool {
+		// filters may be ignored by API, so check them again
+		if intf.NetworkInterfaceName == name && intf.SubnetID == subnetID {
+			matched = append(matched, *intf)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("VPC.API: failed to find interface %s in subnet %s, since: %w", name, subnetID, err)
+	}
+	if len(matched) > 1 {
+		ids := []string{}
+		for _, intf := range matched {
+			ids = append(ids, intf.NetworkInterfaceID)
+		}
+		return nil, &AmbiguousError{Resource: "interface", Key: name, Matches: ids}
+	}
+	if len(matched) == 0 {
+		return nil, nil
+	}
+	return &matched[0], nil
+}
+
+// interfaceDone returns a done check for doInterfaceAction, which tells whether given interface is in expected state
+// by given check, interface is nil if it doesn't exist
+func (c *Client) interfaceDone(ctx context.Context, interfaceID string, check func(intf *DescribeInterfacesNetworkInterface) bool) func() (string, error) {
+	return func() (string, error) {
+		intf, err := c.GetInterface(ctx, interfaceID)
+		if err != nil {
+			return "", err
+		}
+		if !check(intf) {
+			return "", nil
+		}
+		return interfaceID, nil
+	}
+}
+
+// AttachNetworkInterface attaches given interface to given CVM instance
+func (c *Client) AttachNetworkInterface(ctx context.Context, interfaceID, instanceID string) error {
+	unlock, err := c.lockInterfaces(ctx, interfaceID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	params := getBaseParams("AttachNetworkInterface", c.conf.VPCID)
+	params["networkInterfaceId"] = interfaceID
+	params["instanceId"] = instanceID
+	attached := c.interfaceDone(ctx, interfaceID, func(intf *DescribeInterfacesNetworkInterface) bool {
+		return intf != nil && intf.Instance.InstanceID == instanceID
+	})
+	if _, err := c.doInterfaceAction(ctx, params, attached); err != nil {
+		return fmt.Errorf("VPC.API: failed to attach interface %s to %s, since: %w", interfaceID, instanceID, err)
+	}
+	return nil
+}
+
+// DetachNetworkInterface detaches given interface from given CVM instance
+func (c *Client) DetachNetworkInterface(ctx context.Context, interfaceID, instanceID string) error {
+	unlock, err := c.lockInterfaces(ctx, interfaceID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	params := getBaseParams("DetachNetworkInterface", c.conf.VPCID)
+	params["networkInterfaceId"] = interfaceID
+	params["instanceId"] = instanceID
+	detached := c.interfaceDone(ctx, interfaceID, func(intf *DescribeInterfacesNetworkInterface) bool {
+		return intf != nil && intf.Instance.InstanceID == ""
+	})
+	if _, err := c.doInterfaceAction(ctx, params, detached); err != nil {
+		return fmt.Errorf("VPC.API: failed to detach interface %s from %s, since: %w", interfaceID, instanceID, err)
+	}
+	return nil
+}
+
+// SetNetworkInterfaceSecurityGroups binds given security groups to given interface by ModifyNetworkInterfaceAttribute,
+// groups currently bound to the interface are replaced, and the order of groups is the order of rules to be applied
+func (c *Client) SetNetworkInterfaceSecurityGroups(ctx context.Context, interfaceID string, groups []string) error {
+	if len(groups) == 0 {
+		return fmt.Errorf("VPC.API: no security group to set on interface %s", interfaceID)
+	}
+	unlock, err := c.lockInterfaces(ctx, interfaceID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	params := getBaseParams("ModifyNetworkInterfaceAttribute", c.conf.VPCID)
+	params["networkInterfaceId"] = interfaceID
+	for idx, group := range groups {
+		params[fmt.Sprintf("securityGroupIds.%d", idx)] = group
+	}
+	if _, err := c.doInterfaceAction(ctx, params, nil); err != nil {
+		return fmt.Errorf("VPC.API: failed to set security groups %v on interface %s, since: %w", groups, interfaceID, err)
+	}
+	return nil
+}
+
+// DeleteNetworkInterface deletes given interface, the interface should be detached already
+func (c *Client) DeleteNetworkInterface(ctx context.Context, interfaceID string) error {
+	unlock, err := c.lockInterfaces(ctx, interfaceID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	params := getBaseParams("DeleteNetworkInterface", c.conf.VPCID)
+	params["networkInterfaceId"] = interfaceID
+	deleted := c.interfaceDone(ctx, interfaceID, func(intf *DescribeInterfacesNetworkInterface) bool {
+		return intf == nil
+	})
+	if _, err := c.doInterfaceAction(ctx, params, deleted); err != nil {
+		return fmt.Errorf("VPC.API: failed to delete interface %s, since: %w", interfaceID, err)
+	}
+	return nil
+}
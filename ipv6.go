@@ -0,0 +1,161 @@
+package vpcapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// IPFamily is family of an IP address
+type IPFamily string
+
+const (
+	// IPFamilyV4 is family of IPv4 addresses
+	IPFamilyV4 IPFamily = "IPv4"
+	// IPFamilyV6 is family of IPv6 addresses
+	IPFamilyV6 IPFamily = "IPv6"
+)
+
+// GetIPFamily returns family of given IP, IPv4-mapped IPv6 addresses are treated as IPv4
+func GetIPFamily(ip string) (IPFamily, error) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return "", fmt.Errorf("VPC.API: invalid IP %s", ip)
+	}
+	if parsed.To4() != nil {
+		return IPFamilyV4, nil
+	}
+	return IPFamilyV6, nil
+}
+
+// sameIP tells whether given IPs are the same address, different forms of IPv6 address are considered
+func sameIP(a, b string) bool {
+	if a == b {
+		return true
+	}
+	ipA, ipB := net.ParseIP(a), net.ParseIP(b)
+	return ipA != nil && ipB != nil && ipA.Equal(ipB)
+}
+
+// GetInterfaceIPv6s get IPv6 addresses of given interface
+func (c *Client) GetInterfaceIPv6s(ctx context.Context, interfaceID string) ([]string, error) {
+	intf, err := c.GetInterface(ctx, interfaceID)
+	if err != nil {
+		return nil, err
+	}
+	if intf == nil {
+		return nil, &NotFoundError{Resource: "interface", Key: interfaceID}
+	}
+	ips := []string{}
+	for _, ip := range intf.Ipv6AddressSet {
+		ips = append(ips, ip.Address)
+	}
+	return ips, nil
+}
+
+// assignInterfaceIPv6 assigns given IPv6 addresses, or count IPv6 addresses if ips is empty, returns the assigned
+// addresses if response contains them
+func (c *Client) assignInterfaceIPv6(ctx context.Context, interfaceID string, count int, ips []string) ([]string, error) {
+	params := getBaseParams("AssignIpv6Addresses", c.conf.VPCID)
+	params["networkInterfaceId"] = interfaceID
+	if len(ips) > 0 {
+		for idx, ip := range ips {
+			params[fmt.Sprintf("ipv6Addresses.%d.address", idx)] = ip
+		}
+	} else {
+		params["ipv6AddressCount"] = strconv.Itoa(count)
+	}
+	resp, err := c.doRequest(ctx, params)
+	if err != nil {
+		return nil, fmt.Errorf("VPC.API: assignInterfaceIPv6 doRequest failed with: %w", err)
+	}
+	assignResp := Ipv6AddressesActionResponse{}
+	if err := json.Unmarshal(resp, &assignResp); err != nil {
+		return nil, fmt.Errorf("VPC.API: assignInterfaceIPv6 failed to do json unmarshal, since: %v", err)
+	}
+	assigned := []string{}
+	for _, ip := range assignResp.Data.Ipv6AddressSet {
+		assigned = append(assigned, ip.Address)
+	}
+	return assigned, nil
+}
+
+func (c *Client) releaseInterfaceIPv6(ctx context.Context, interfaceID string, ips []string) error {
+	params := getBaseParams("UnassignIpv6Addresses", c.conf.VPCID)
+	params["networkInterfaceId"] = interfaceID
+	for idx, ip := range ips {
+		params[fmt.Sprintf("ipv6Addresses.%d.address", idx)] = ip
+	}
+	resp, err := c.doRequest(ctx, params)
+	if err != nil {
+		return fmt.Errorf("VPC.API: releaseInterfaceIPv6 doRequest failed with: %w", err)
+	}
+	releaseResp := Ipv6AddressesActionResponse{}
+	if err := json.Unmarshal(resp, &releaseResp); err != nil {
+		return fmt.Errorf("VPC.API: releaseInterfaceIPv6 failed to do json unmarshal, since: %v", err)
+	}
+	return nil
+}
+
+// AssignIPv6s will invoke VPC API to assign given IPv6 addresses, or count IPv6 addresses if ips is empty, to given
+// interface, and returns the new assigned addresses. If the response doesn't contain them, they are got by comparing
+// interface IPv6 addresses before and after the assignment.
+func (c *Client) AssignIPv6s(ctx context.Context, interfaceID string, count int, ips []string) ([]string, error) {
+	if len(ips) == 0 && count <= 0 {
+		return nil, fmt.Errorf("VPC.API: invalid IPv6 address count %d to assign for interface %s", count, interfaceID)
+	}
+	unlock, err := c.lockInterfaces(ctx, interfaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	for _, ip := range ips {
+		if family, err := GetIPFamily(ip); err != nil || family != IPFamilyV6 {
+			return nil, fmt.Errorf("VPC.API: invalid IPv6 address %s", ip)
+		}
+	}
+	originIPs, err := c.GetInterfaceIPv6s(ctx, interfaceID)
+	if err != nil {
+		return nil, err
+	}
+	want := count
+	if len(ips) > 0 {
+		want = len(ips)
+	}
+	policy := c.getRetryPolicy(c.conf.IPAssign.Retry, c.conf.IPAssign.Interval)
+	assigned, err := c.retryAssign(ctx, policy, originIPs, want, func() ([]string, error) {
+		return c.GetInterfaceIPv6s(ctx, interfaceID)
+	}, func() ([]string, error) {
+		return c.assignInterfaceIPv6(ctx, interfaceID, count, ips)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("VPC.API: failed to assign IPv6 addresses for interface %s, since: %w", interfaceID, err)
+	}
+	if len(assigned) > 0 {
+		return assigned, nil
+	}
+	current, err := c.GetInterfaceIPv6s(ctx, interfaceID)
+	if err != nil {
+		return nil, err
+	}
+	return diffIPs(current, originIPs), nil
+}
+
+// ReleaseIPv6s will invoke VPC API to release given IPv6 addresses on given interface
+func (c *Client) ReleaseIPv6s(ctx context.Context, interfaceID string, ips []string) error {
+	unlock, err := c.lockInterfaces(ctx, interfaceID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	policy := c.getRetryPolicy(c.conf.IPRelease.Retry, c.conf.IPRelease.Interval)
+	err = c.retry(ctx, policy, func(int) error {
+		return c.releaseInterfaceIPv6(ctx, interfaceID, ips)
+	})
+	if err != nil {
+		return fmt.Errorf("VPC.API: failed to release IPv6 addresses %v on %s, since: %w", ips, interfaceID, err)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package vpcapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// GetInterfaceLimit returns network interface quota of given instance. Quota in instanceTypeLimits of config is used
+// if set, otherwise it's got by DescribeNetworkInterfaceLimit, and cached by instance type.
+func (c *Client) GetInterfaceLimit(ctx context.Context, instance *Instance) (InterfaceLimit, error) {
+	if limit, ok := c.conf.InstanceTypeLimits[instance.InstanceType]; ok {
+		return limit, nil
+	}
+	if limit, ok := c.getCachedInterfaceLimit(instance.InstanceType); ok {
+		return limit, nil
+	}
+	params := getBaseParams("DescribeNetworkInterfaceLimit", c.conf.VPCID)
+	params["instanceId"] = instance.InstanceID
+	resp, err := c.doRequest(ctx, params)
+	if err != nil {
+		return InterfaceLimit{}, fmt.Errorf("VPC.API: DescribeNetworkInterfaceLimit doRequest failed with: %w", err)
+	}
+	limitResp := &DescribeNetworkInterfaceLimitResponse{}
+	if err := json.Unmarshal(resp, limitResp); err != nil {
+		return InterfaceLimit{}, fmt.Errorf("VPC.API: DescribeNetworkInterfaceLimit failed to do json unmarshal, since: %v", err)
+	}
+	if instance.InstanceType != "" {
+		c.limitsMutex.Lock()
+		c.limits[instance.InstanceType] = limitResp.Data
+		c.limitsMutex.Unlock()
+	}
+	return limitResp.Data, nil
+}
+
+func (c *Client) getCachedInterfaceLimit(instanceType string) (InterfaceLimit, bool) {
+	c.limitsMutex.RLock()
+	defer c.limitsMutex.RUnlock()
+	limit, ok := c.limits[instanceType]
+	return limit, ok
+}
+
+// PickInterfaceForInstance picks an interface from interfaces of given instance, with interface quota of the instance
+// and available IPs of subnets, so full interfaces and interfaces in exhausted subnets are skipped. If *NoCapacityError
+// returned, NeedNewInterface tells whether a new interface should be created and attached to the instance.
+func (c *Client) PickInterfaceForInstance(ctx context.Context, instance *Instance, req *PickRequest) (int, string, error) {
+	limit, err := c.GetInterfaceLimit(ctx, instance)
+	if err != nil {
+		return -1, "", err
+	}
+	req.Limit = limit
+	if req.SubnetAvailableIPs == nil {
+		available, err := c.GetSubnetAvailableIPs(ctx, req.Interfaces)
+		if err != nil {
+			return -1, "", err
+		}
+		req.SubnetAvailableIPs = available
+	}
+	return c.PickInterface(req)
+}
+
+// NeedNewInterface tells whether err is *NoCapacityError which requires a new interface
+func NeedNewInterface(err error) bool {
+	noCapacityErr := &NoCapacityError{}
+	return errors.As(err, &noCapacityErr) && noCapacityErr.NeedNewInterface
+}
@@ -0,0 +1,89 @@
+package vpcapi
+
+import (
+	"context"
+	"strings"
+
+	"github.com/von1994/vpcapi/metadata"
+)
+
+// WithMetadataClient makes Client find out the local instance with given metadata client
+func WithMetadataClient(metadataClient *metadata.Client) Option {
+	return func(c *Client) {
+		c.metadata = metadataClient
+	}
+}
+
+// Metadata returns metadata client used by Client
+func (c *Client) Metadata() *metadata.Client {
+	return c.metadata
+}
+
+// LocalInstanceID returns ID of the local instance. InstanceID in config is used if set, otherwise it's got from
+// metadata service and cached.
+func (c *Client) LocalInstanceID(ctx context.Context) (string, error) {
+	if c.conf.InstanceID != "" {
+		return c.conf.InstanceID, nil
+	}
+	c.localMutex.Lock()
+	defer c.localMutex.Unlock()
+	if c.localInstanceID != "" {
+		return c.localInstanceID, nil
+	}
+	instanceID, err := c.metadata.InstanceID(ctx)
+	if err != nil {
+		return "", err
+	}
+	c.localInstanceID = instanceID
+	return instanceID, nil
+}
+
+// LocalInterfaces returns network interfaces of the local instance keyed by MAC in lower case. It only queries
+// metadata service, so no cloud API is called.
+func (c *Client) LocalInterfaces(ctx context.Context) (map[string]metadata.Interface, error) {
+	interfaces, err := c.metadata.Interfaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[string]metadata.Interface, len(interfaces))
+	for _, intf := range interfaces {
+		ret[strings.ToLower(intf.MAC)] = intf
+	}
+	return ret, nil
+}
+
+// ResolveLocalInterfaces returns network interfaces of the local instance keyed by MAC in lower case, so interface ID
+// can be found by MAC seen inside of CVM. They are built from metadata service only, so no cloud API is called, and
+// only fields known by metadata service are set.
+func (c *Client) ResolveLocalInterfaces(ctx context.Context) (map[string]DescribeInterfacesNetworkInterface, error) {
+	instanceID, err := c.LocalInstanceID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	localIP, err := c.metadata.LocalIPv4(ctx)
+	if err != nil {
+		return nil, err
+	}
+	interfaces, err := c.metadata.Interfaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[string]DescribeInterfacesNetworkInterface, len(interfaces))
+	for _, intf := range interfaces {
+		resolved := DescribeInterfacesNetworkInterface{
+			Instance:           DescribeInterfacesInstance{InstanceID: instanceID},
+			MacAddress:         intf.MAC,
+			NetworkInterfaceID: intf.InterfaceID,
+			// primary IP of the primary interface is the private IP of the instance
+			Primary: intf.PrimaryLocalIPv4 == localIP,
+		}
+		for _, ip := range intf.LocalIPv4s {
+			resolved.PrivateIPAddressSet = append(resolved.PrivateIPAddressSet, DescribeInterfacesPrivateIPAddresses{
+				Primary:          ip == intf.PrimaryLocalIPv4,
+				PrivateIPAddress: ip,
+			})
+		}
+		ret[strings.ToLower(intf.MAC)] = resolved
+	}
+	return ret, nil
+}
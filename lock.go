@@ -0,0 +1,100 @@
+package vpcapi
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// InterfaceLocker serializes mutating operations on the same network interface, like assigning, releasing and
+// migrating IPs, so concurrent callers queue instead of colliding with "resource busy" errors. Lock blocks until the
+// lock of given interface is acquired or ctx is done, unlock must be called once the operation is done.
+type InterfaceLocker interface {
+	Lock(ctx context.Context, interfaceID string) (unlock func(), err error)
+}
+
+// WithInterfaceLocker makes Client serialize operations on interfaces with given locker besides of the in-process
+// lock, like *EtcdInterfaceLocker to serialize them across processes and nodes
+func WithInterfaceLocker(locker InterfaceLocker) Option {
+	return func(c *Client) {
+		c.interfaceLocker = locker
+	}
+}
+
+// localInterfaceLocker is an in-process InterfaceLocker, locks are removed once nobody holds or waits for them
+type localInterfaceLocker struct {
+	mutex sync.Mutex
+	locks map[string]*interfaceLock
+}
+
+type interfaceLock struct {
+	ch   chan struct{}
+	refs int
+}
+
+// processInterfaceLocker is the only in-process locker, since a locker per client would let two clients of the same
+// process change one interface at once, e.g. CNI assigning an IP while releasing another
+var processInterfaceLocker = &localInterfaceLocker{locks: map[string]*interfaceLock{}}
+
+// Lock implements InterfaceLocker
+func (l *localInterfaceLocker) Lock(ctx context.Context, interfaceID string) (func(), error) {
+	l.mutex.Lock()
+	lock, ok := l.locks[interfaceID]
+	if !ok {
+		lock = &interfaceLock{ch: make(chan struct{}, 1)}
+		l.locks[interfaceID] = lock
+	}
+	lock.refs++
+	l.mutex.Unlock()
+	select {
+	case lock.ch <- struct{}{}:
+		return func() {
+			<-lock.ch
+			l.put(interfaceID, lock)
+		}, nil
+	case <-ctx.Done():
+		l.put(interfaceID, lock)
+		return nil, ctx.Err()
+	}
+}
+
+func (l *localInterfaceLocker) put(interfaceID string, lock *interfaceLock) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	lock.refs--
+	if lock.refs == 0 {
+		delete(l.locks, interfaceID)
+	}
+}
+
+// lockInterfaces locks given interfaces with in-process locker, then with external locker if set. Interfaces are
+// locked in order of ID, so callers locking the same interfaces won't deadlock.
+func (c *Client) lockInterfaces(ctx context.Context, interfaceIDs ...string) (func(), error) {
+	ids := []string{}
+	for _, id := range interfaceIDs {
+		if !containsString(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	unlocks := []func(){}
+	unlockAll := func() {
+		for i := len(unlocks) - 1; i >= 0; i-- {
+			unlocks[i]()
+		}
+	}
+	for _, id := range ids {
+		for _, locker := range []InterfaceLocker{c.localLocker, c.interfaceLocker} {
+			if locker == nil {
+				continue
+			}
+			unlock, err := locker.Lock(ctx, id)
+			if err != nil {
+				unlockAll()
+				return nil, err
+			}
+			unlocks = append(unlocks, unlock)
+		}
+	}
+	return unlockAll, nil
+}
@@ -0,0 +1,98 @@
+package metadata
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// FakeData is data served by Fake
+type FakeData struct {
+	InstanceID string
+	Region     string
+	Zone       string
+	LocalIPv4  string
+	Interfaces []Interface
+	// CAMRole is name of CAM role bound to the instance, with CAMCredentials as its credential
+	CAMRole        string
+	CAMCredentials *RoleCredentials
+}
+
+// Fake is a fake metadata service for tests, it serves paths under "/latest/meta-data/" with FakeData
+type Fake struct {
+	mu   sync.RWMutex
+	data FakeData
+}
+
+// NewFake creates a fake metadata service with given data
+func NewFake(data FakeData) *Fake {
+	return &Fake{data: data}
+}
+
+// Set replaces data served by fake
+func (f *Fake) Set(data FakeData) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.data = data
+}
+
+func (f *Fake) lookup(path string) (string, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	switch path {
+	case "instance-id":
+		return f.data.InstanceID, true
+	case "placement/region":
+		return f.data.Region, true
+	case "placement/zone":
+		return f.data.Zone, true
+	case "local-ipv4":
+		return f.data.LocalIPv4, true
+	case "cam/security-credentials/":
+		if f.data.CAMRole == "" {
+			return "", true
+		}
+		return f.data.CAMRole, true
+	case "cam/security-credentials/" + f.data.CAMRole:
+		if f.data.CAMRole == "" || f.data.CAMCredentials == nil {
+			return "", false
+		}
+		data, _ := json.Marshal(f.data.CAMCredentials)
+		return string(data), true
+	case "network/interfaces/macs/":
+		macs := []string{}
+		for _, intf := range f.data.Interfaces {
+			macs = append(macs, intf.MAC+"/")
+		}
+		return strings.Join(macs, "\n"), true
+	}
+	for _, intf := range f.data.Interfaces {
+		prefix := "network/interfaces/macs/" + intf.MAC + "/"
+		switch path {
+		case prefix + "eni-id":
+			return intf.InterfaceID, true
+		case prefix + "primary-local-ipv4":
+			return intf.PrimaryLocalIPv4, true
+		case prefix + "local-ipv4s/":
+			ips := []string{}
+			for _, ip := range intf.LocalIPv4s {
+				ips = append(ips, ip+"/")
+			}
+			return strings.Join(ips, "\n"), true
+		}
+	}
+	return "", false
+}
+
+// ServeHTTP implements http.Handler
+func (f *Fake) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/latest/meta-data/")
+	value, ok := f.lookup(path)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	io.WriteString(w, value)
+}
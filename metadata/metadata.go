@@ -0,0 +1,190 @@
+// Package metadata is a client for the instance metadata service inside of CVM. The service needs no credentials, so
+// CNI can use it to find out the local instance and its network interfaces without calling cloud API.
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultEndpoint is endpoint of metadata service inside of CVM
+	DefaultEndpoint = "http://metadata.tencentyun.com/latest/meta-data/"
+
+	defaultTimeout = 2 * time.Second
+	// maxValueSize is the max size of a value, values of metadata service are small, so larger ones are refused
+	maxValueSize = 64 * 1024
+)
+
+// Interface is a network interface described by metadata service
+type Interface struct {
+	MAC              string
+	InterfaceID      string
+	PrimaryLocalIPv4 string
+	LocalIPv4s       []string
+}
+
+// RoleCredentials is temporary credential of CAM role bound to the local instance
+type RoleCredentials struct {
+	TmpSecretID  string `json:"TmpSecretId"`
+	TmpSecretKey string `json:"TmpSecretKey"`
+	Token        string `json:"Token"`
+	ExpiredTime  int64  `json:"ExpiredTime"`
+	Expiration   string `json:"Expiration"`
+	Code         string `json:"Code"`
+}
+
+// Client is a client for metadata service
+type Client struct {
+	endpoint   string
+	httpClient *http.Client
+}
+
+// NewClient creates a metadata client with given endpoint and http client, DefaultEndpoint is used if endpoint is
+// empty, and a http client with 2s timeout is used if httpClient is nil
+func NewClient(endpoint string, httpClient *http.Client) *Client {
+	if endpoint == "" {
+		endpoint = DefaultEndpoint
+	}
+	if !strings.HasSuffix(endpoint, "/") {
+		endpoint += "/"
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: defaultTimeout}
+	}
+	return &Client{endpoint: endpoint, httpClient: httpClient}
+}
+
+// Get returns value of given path under endpoint, like "instance-id"
+func (c *Client) Get(ctx context.Context, path string) (string, error) {
+	req, err := http.NewRequest("GET", c.endpoint+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		return "", fmt.Errorf("Metadata: failed to get %s, since: %v", path, err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxValueSize+1))
+	if err != nil {
+		return "", fmt.Errorf("Metadata: failed to read %s, since: %v", path, err)
+	}
+	if len(body) > maxValueSize {
+		return "", fmt.Errorf("Metadata: value of %s exceeds max size %d bytes", path, maxValueSize)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Metadata: failed to get %s, status %d", path, resp.StatusCode)
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+// list returns items of given directory path, trailing "/" of items are trimmed
+func (c *Client) list(ctx context.Context, path string) ([]string, error) {
+	value, err := c.Get(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	items := []string{}
+	for _, line := range strings.Split(value, "\n") {
+		if item := strings.TrimSuffix(strings.TrimSpace(line), "/"); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+// InstanceID returns ID of the local instance
+func (c *Client) InstanceID(ctx context.Context) (string, error) {
+	return c.Get(ctx, "instance-id")
+}
+
+// Region returns region of the local instance
+func (c *Client) Region(ctx context.Context) (string, error) {
+	return c.Get(ctx, "placement/region")
+}
+
+// Zone returns zone of the local instance
+func (c *Client) Zone(ctx context.Context) (string, error) {
+	return c.Get(ctx, "placement/zone")
+}
+
+// LocalIPv4 returns primary private IP of the local instance
+func (c *Client) LocalIPv4(ctx context.Context) (string, error) {
+	return c.Get(ctx, "local-ipv4")
+}
+
+// MACs returns MAC addresses of network interfaces of the local instance
+func (c *Client) MACs(ctx context.Context) ([]string, error) {
+	return c.list(ctx, "network/interfaces/macs/")
+}
+
+// InterfaceID returns ID of network interface with given MAC
+func (c *Client) InterfaceID(ctx context.Context, mac string) (string, error) {
+	return c.Get(ctx, fmt.Sprintf("network/interfaces/macs/%s/eni-id", mac))
+}
+
+// PrimaryLocalIPv4 returns primary private IP of network interface with given MAC
+func (c *Client) PrimaryLocalIPv4(ctx context.Context, mac string) (string, error) {
+	return c.Get(ctx, fmt.Sprintf("network/interfaces/macs/%s/primary-local-ipv4", mac))
+}
+
+// LocalIPv4s returns all private IPs of network interface with given MAC
+func (c *Client) LocalIPv4s(ctx context.Context, mac string) ([]string, error) {
+	return c.list(ctx, fmt.Sprintf("network/interfaces/macs/%s/local-ipv4s/", mac))
+}
+
+// CAMRoles returns names of CAM roles bound to the local instance
+func (c *Client) CAMRoles(ctx context.Context) ([]string, error) {
+	return c.list(ctx, "cam/security-credentials/")
+}
+
+// CAMRoleCredentials returns temporary credential of given CAM role bound to the local instance
+func (c *Client) CAMRoleCredentials(ctx context.Context, role string) (*RoleCredentials, error) {
+	value, err := c.Get(ctx, "cam/security-credentials/"+role)
+	if err != nil {
+		return nil, err
+	}
+	cred := &RoleCredentials{}
+	if err := json.Unmarshal([]byte(value), cred); err != nil {
+		return nil, fmt.Errorf("Metadata: failed to parse credential of role %s, since: %v", role, err)
+	}
+	if cred.Code != "" && cred.Code != "Success" {
+		return nil, fmt.Errorf("Metadata: failed to get credential of role %s, code %s", role, cred.Code)
+	}
+	return cred, nil
+}
+
+// Interfaces returns all network interfaces of the local instance
+func (c *Client) Interfaces(ctx context.Context) ([]Interface, error) {
+	macs, err := c.MACs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	interfaces := []Interface{}
+	for _, mac := range macs {
+		interfaceID, err := c.InterfaceID(ctx, mac)
+		if err != nil {
+			return nil, err
+		}
+		primaryIP, err := c.PrimaryLocalIPv4(ctx, mac)
+		if err != nil {
+			return nil, err
+		}
+		ips, err := c.LocalIPv4s(ctx, mac)
+		if err != nil {
+			return nil, err
+		}
+		interfaces = append(interfaces, Interface{MAC: mac, InterfaceID: interfaceID, PrimaryLocalIPv4: primaryIP, LocalIPv4s: ips})
+	}
+	return interfaces, nil
+}
@@ -0,0 +1,123 @@
+package vpcapi
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+)
+
+const (
+	// interfacesPageLimit is the max limit of one DescribeNetworkInterfaces request
+	interfacesPageLimit = 50
+	// instancesPageLimit is the max limit of one DescribeInstances request
+	instancesPageLimit = 100
+)
+
+// isLastPage tells whether paging should stop after a page with given size, total is trusted only if it's positive,
+// since it's missing in some responses
+func isLastPage(pageSize, limit, offset, total int) bool {
+	return pageSize < limit || (total > 0 && offset >= total)
+}
+
+// InterfaceFilter defines conditions to list network interfaces, empty fields are ignored
+type InterfaceFilter struct {
+	InstanceID           string
+	NetworkInterfaceID   string
+	SubnetID             string
+	NetworkInterfaceName string
+	// PrivateIPAddress is sent as filter "address-ip", API may ignore it, so callers should check it in results
+	PrivateIPAddress string
+}
+
+func (f InterfaceFilter) params(vpcID string) map[string]string {
+	params := getDescribeNetworkInterfacesParams(vpcID)
+	if f.InstanceID != "" {
+		params["instanceId"] = f.InstanceID
+	}
+	if f.NetworkInterfaceID != "" {
+		params["networkInterfaceId"] = f.NetworkInterfaceID
+	}
+	if f.SubnetID != "" {
+		params["subnetId"] = f.SubnetID
+	}
+	if f.NetworkInterfaceName != "" {
+		params["networkInterfaceName"] = f.NetworkInterfaceName
+	}
+	if f.PrivateIPAddress != "" {
+		params["address-ip"] = f.PrivateIPAddress
+	}
+	return params
+}
+
+// ForEachInterface lists network interfaces in vpc matching given filter page by page, and calls fn for each of them,
+// until fn returns false or all interfaces are iterated.
+func (c *Client) ForEachInterface(ctx context.Context, filter InterfaceFilter, fn func(intf *DescribeInterfacesNetworkInterface) bool) error {
+	for offset := 0; ; {
+		params := filter.params(c.conf.VPCID)
+		params["offset"] = strconv.Itoa(offset)
+		params["limit"] = strconv.Itoa(interfacesPageLimit)
+		resp, err := c.doRequest(ctx, params)
+		if err != nil {
+			return err
+		}
+		describeInterfacesResp := &DescribeInterfacesResponse{}
+		if err = json.Unmarshal(resp, describeInterfacesResp); err != nil {
+			return err
+		}
+		page := describeInterfacesResp.Data.Data
+		for idx := range page {
+			if !fn(&page[idx]) {
+				return nil
+			}
+		}
+		offset += len(page)
+		if isLastPage(len(page), interfacesPageLimit, offset, describeInterfacesResp.Data.TotalNum) {
+			return nil
+		}
+	}
+}
+
+// InstanceFilter defines conditions to list CVM instances, empty fields are ignored
+type InstanceFilter struct {
+	PrivateIPAddress string
+}
+
+func (f InstanceFilter) params() map[string]string {
+	params := map[string]string{
+		"Action":  "DescribeInstances",
+		"Version": "2017-03-12",
+		"Service": "cvm",
+	}
+	if f.PrivateIPAddress != "" {
+		params["private-ip-address"] = f.PrivateIPAddress
+	}
+	return params
+}
+
+// ForEachInstance lists CVM instances matching given filter page by page, and calls fn for each of them, until fn
+// returns false or all instances are iterated.
+func (c *Client) ForEachInstance(ctx context.Context, filter InstanceFilter, fn func(instance *CVMDescribeInstancesInstance) bool) error {
+	for offset := 0; ; {
+		params := filter.params()
+		params["Offset"] = strconv.Itoa(offset)
+		params["Limit"] = strconv.Itoa(instancesPageLimit)
+		resp, err := c.doRequest(ctx, params)
+		if err != nil {
+			return err
+		}
+		cvmResp := &CVMDescribeInstancesResponse{}
+		if err = json.Unmarshal(resp, cvmResp); err != nil {
+			return err
+		}
+		page := cvmResp.Body.InstanceSet
+		for idx := range page {
+			if !fn(&page[idx]) {
+				return nil
+			}
+		}
+		offset += len(page)
+		if isLastPage(len(page), instancesPageLimit, offset, cvmResp.Body.TotalCount) {
+			return nil
+		}
+	}
+}
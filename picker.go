@@ -0,0 +1,345 @@
+package vpcapi
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// VPCPolicyLeastLoaded picks the interface with the fewest IPs
+	VPCPolicyLeastLoaded = "LeastLoaded"
+	// VPCPolicyMostLoaded picks the interface with the most IPs but still has capacity, to pack pods on fewer interfaces
+	VPCPolicyMostLoaded = "MostLoaded"
+	// VPCPolicyRoundRobin picks interfaces in turn
+	VPCPolicyRoundRobin = "RoundRobin"
+	// VPCPolicySubnetPreferred picks the least loaded interface in preferred subnets, and falls back to other subnets
+	VPCPolicySubnetPreferred = "SubnetPreferred"
+	// VPCPolicyMACPinned picks the interface with given MAC address only, like MAC in AnnoKeyVPCNICMAC
+	VPCPolicyMACPinned = "MACPinned"
+)
+
+// PickRequest is the input for InterfacePicker
+type PickRequest struct {
+	Interfaces []DescribeInterfacesNetworkInterface
+	// MAC is required by VPCPolicyMACPinned
+	MAC string
+	// Subnets overrides preferredSubnets in picker options for VPCPolicySubnetPreferred
+	Subnets []string
+	// RequiredSubnets makes interfaces not in these subnets skipped by all pickers, like subnets in AnnoKeyVPCSubnet
+	RequiredSubnets []string
+	// SubnetAvailableIPs is number of available IPs keyed by subnet ID, interfaces in subnets without available IPs are
+	// skipped; subnets not in it are treated as unknown
+	SubnetAvailableIPs map[string]int
+	// Limit is interface quota of the instance, if ENIPrivateIPAddressQuantity set, it overrides maxIPsPerInterface in
+	// picker options; zero fields mean unknown
+	Limit InterfaceLimit
+}
+
+// InterfacePicker picks an interface for pod from interfaces of an instance. It returns index of the chosen interface
+// and the reason of the choice, or *NoCapacityError if no interface can be used.
+type InterfacePicker interface {
+	Pick(req *PickRequest) (int, string, error)
+}
+
+// PickerFactory creates an InterfacePicker with vpc config
+type PickerFactory func(conf VPC) InterfacePicker
+
+// PickerOptions defines options for interface pickers
+type PickerOptions struct {
+	// IncludePrimary makes primary interface can be picked, it's always true for VPCPolicySharePrimary
+	IncludePrimary bool `json:"includePrimary,omitempty"`
+	// MaxIPsPerInterface makes interfaces with this number of IPs, including the primary IP, skipped, 0 means no limit
+	MaxIPsPerInterface int `json:"maxIPsPerInterface,omitempty"`
+	// PreferredSubnets is used by VPCPolicySubnetPreferred
+	PreferredSubnets []string `json:"preferredSubnets,omitempty"`
+}
+
+// NoCapacityError is returned by InterfacePicker if no interface can be used
+type NoCapacityError struct {
+	Policy string
+	Reason string
+	// NeedNewInterface is true if all interfaces are full, while more interfaces can be attached to the instance
+	NeedNewInterface bool
+	// LimitUnknown is true if interface quota of the instance is not resolved, so NeedNewInterface is false, since
+	// whether more interfaces can be attached is unknown
+	LimitUnknown bool
+}
+
+func (e *NoCapacityError) Error() string {
+	return fmt.Sprintf("VPC.API: no interface has capacity with policy %s, since: %s", e.Policy, e.Reason)
+}
+
+var (
+	pickersMutex sync.RWMutex
+	pickers      = map[string]PickerFactory{}
+)
+
+func init() {
+	RegisterInterfacePicker(VPCPolicyExclusive, newExclusivePicker)
+	RegisterInterfacePicker(VPCPolicyShare, newLeastLoadedPicker)
+	RegisterInterfacePicker(VPCPolicySharePrimary, newLeastLoadedPicker)
+	RegisterInterfacePicker(VPCPolicyLeastLoaded, newLeastLoadedPicker)
+	RegisterInterfacePicker(VPCPolicyMostLoaded, newMostLoadedPicker)
+	RegisterInterfacePicker(VPCPolicyRoundRobin, newRoundRobinPicker)
+	RegisterInterfacePicker(VPCPolicySubnetPreferred, newSubnetPreferredPicker)
+	RegisterInterfacePicker(VPCPolicyMACPinned, newMACPinnedPicker)
+}
+
+// RegisterInterfacePicker registers picker factory with policy name, so it can be selected by policy in vpc config.
+// Picker registered with the same name will be replaced.
+func RegisterInterfacePicker(name string, factory PickerFactory) {
+	pickersMutex.Lock()
+	defer pickersMutex.Unlock()
+	pickers[name] = factory
+}
+
+// NewInterfacePicker creates picker based on policy in given vpc config, VPCPolicyShare is used if policy is not set
+func NewInterfacePicker(conf VPC) (InterfacePicker, error) {
+	policy := conf.Policy
+	if policy == "" {
+		policy = VPCPolicyShare
+	}
+	pickersMutex.RLock()
+	factory, ok := pickers[policy]
+	pickersMutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("VPC.API: unknown interface picker policy %s", policy)
+	}
+	return factory(conf), nil
+}
+
+// basePicker contains common logic to filter interfaces for pickers
+type basePicker struct {
+	policy  string
+	options PickerOptions
+}
+
+func newBasePicker(conf VPC) basePicker {
+	policy := conf.Policy
+	if policy == "" {
+		policy = VPCPolicyShare
+	}
+	options := conf.Picker
+	if policy == VPCPolicySharePrimary {
+		options.IncludePrimary = true
+	}
+	return basePicker{policy: policy, options: options}
+}
+
+func (p *basePicker) maxIPs(req *PickRequest) int {
+	if req.Limit.ENIPrivateIPAddressQuantity > 0 {
+		return req.Limit.ENIPrivateIPAddressQuantity
+	}
+	return p.options.MaxIPsPerInterface
+}
+
+// candidates returns indexes of interfaces can be picked, and reason if there is none
+func (p *basePicker) candidates(req *PickRequest) ([]int, string) {
+	indexes := []int{}
+	full, otherSubnet, exhausted := 0, 0, 0
+	maxIPs := p.maxIPs(req)
+	for idx, intf := range req.Interfaces {
+		if intf.Primary && !p.options.IncludePrimary {
+			continue
+		}
+		if len(req.RequiredSubnets) > 0 && !containsString(req.RequiredSubnets, intf.SubnetID) {
+			otherSubnet++
+			continue
+		}
+		if available, ok := req.SubnetAvailableIPs[intf.SubnetID]; ok && available <= 0 {
+			exhausted++
+			continue
+		}
+		if maxIPs > 0 && len(intf.PrivateIPAddressSet) >= maxIPs {
+			full++
+			continue
+		}
+		indexes = append(indexes, idx)
+	}
+	if len(indexes) == 0 {
+		return nil, fmt.Sprintf("%d interfaces in total, %d of them are not in subnets %v, %d of them are in subnets without available IPs, %d of them are full with %d IPs",
+			len(req.Interfaces), otherSubnet, req.RequiredSubnets, exhausted, full, maxIPs)
+	}
+	return indexes, ""
+}
+
+// noCapacity returns *NoCapacityError, a new interface is needed if quota of the instance is known and allows
+func (p *basePicker) noCapacity(req *PickRequest, reason string) error {
+	return &NoCapacityError{
+		Policy:           p.policy,
+		Reason:           reason,
+		NeedNewInterface: req.Limit.ENIQuantity > 0 && len(req.Interfaces) < req.Limit.ENIQuantity,
+		LimitUnknown:     req.Limit.ENIQuantity == 0,
+	}
+}
+
+// leastLoaded returns index in indexes with the fewest IPs
+func leastLoaded(interfaces []DescribeInterfacesNetworkInterface, indexes []int) int {
+	chosen := indexes[0]
+	for _, idx := range indexes[1:] {
+		if len(interfaces[idx].PrivateIPAddressSet) < len(interfaces[chosen].PrivateIPAddressSet) {
+			chosen = idx
+		}
+	}
+	return chosen
+}
+
+type exclusivePicker struct {
+	basePicker
+}
+
+func newExclusivePicker(conf VPC) InterfacePicker {
+	return &exclusivePicker{newBasePicker(conf)}
+}
+
+// Pick implements InterfacePicker, only interface with only primary IP can be picked
+func (p *exclusivePicker) Pick(req *PickRequest) (int, string, error) {
+	indexes, reason := p.candidates(req)
+	for _, idx := range indexes {
+		if len(req.Interfaces[idx].PrivateIPAddressSet) == 1 {
+			return idx, "interface has no secondary IP", nil
+		}
+	}
+	if reason == "" {
+		reason = "all interfaces have secondary IPs"
+	}
+	return -1, "", p.noCapacity(req, reason)
+}
+
+type leastLoadedPicker struct {
+	basePicker
+}
+
+func newLeastLoadedPicker(conf VPC) InterfacePicker {
+	return &leastLoadedPicker{newBasePicker(conf)}
+}
+
+// Pick implements InterfacePicker
+func (p *leastLoadedPicker) Pick(req *PickRequest) (int, string, error) {
+	indexes, reason := p.candidates(req)
+	if len(indexes) == 0 {
+		return -1, "", p.noCapacity(req, reason)
+	}
+	chosen := leastLoaded(req.Interfaces, indexes)
+	return chosen, fmt.Sprintf("interface has the fewest IPs %d", len(req.Interfaces[chosen].PrivateIPAddressSet)), nil
+}
+
+type mostLoadedPicker struct {
+	basePicker
+}
+
+func newMostLoadedPicker(conf VPC) InterfacePicker {
+	return &mostLoadedPicker{newBasePicker(conf)}
+}
+
+// Pick implements InterfacePicker
+func (p *mostLoadedPicker) Pick(req *PickRequest) (int, string, error) {
+	indexes, reason := p.candidates(req)
+	if len(indexes) == 0 {
+		return -1, "", p.noCapacity(req, reason)
+	}
+	chosen := indexes[0]
+	for _, idx := range indexes[1:] {
+		if len(req.Interfaces[idx].PrivateIPAddressSet) > len(req.Interfaces[chosen].PrivateIPAddressSet) {
+			chosen = idx
+		}
+	}
+	return chosen, fmt.Sprintf("interface has the most IPs %d with capacity left", len(req.Interfaces[chosen].PrivateIPAddressSet)), nil
+}
+
+type roundRobinPicker struct {
+	basePicker
+	mutex sync.Mutex
+	last  string
+}
+
+func newRoundRobinPicker(conf VPC) InterfacePicker {
+	return &roundRobinPicker{basePicker: newBasePicker(conf)}
+}
+
+// Pick implements InterfacePicker, interfaces are ordered by ID, and the one next to the last picked is chosen
+func (p *roundRobinPicker) Pick(req *PickRequest) (int, string, error) {
+	indexes, reason := p.candidates(req)
+	if len(indexes) == 0 {
+		return -1, "", p.noCapacity(req, reason)
+	}
+	sort.Slice(indexes, func(i, j int) bool {
+		return req.Interfaces[indexes[i]].NetworkInterfaceID < req.Interfaces[indexes[j]].NetworkInterfaceID
+	})
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	chosen := indexes[0]
+	for _, idx := range indexes {
+		if req.Interfaces[idx].NetworkInterfaceID > p.last {
+			chosen = idx
+			break
+		}
+	}
+	p.last = req.Interfaces[chosen].NetworkInterfaceID
+	return chosen, "interface is next in turn", nil
+}
+
+type subnetPreferredPicker struct {
+	basePicker
+}
+
+func newSubnetPreferredPicker(conf VPC) InterfacePicker {
+	return &subnetPreferredPicker{newBasePicker(conf)}
+}
+
+// Pick implements InterfacePicker
+func (p *subnetPreferredPicker) Pick(req *PickRequest) (int, string, error) {
+	indexes, reason := p.candidates(req)
+	if len(indexes) == 0 {
+		return -1, "", p.noCapacity(req, reason)
+	}
+	subnets := req.Subnets
+	if len(subnets) == 0 {
+		subnets = p.options.PreferredSubnets
+	}
+	preferred := []int{}
+	for _, idx := range indexes {
+		if containsString(subnets, req.Interfaces[idx].SubnetID) {
+			preferred = append(preferred, idx)
+		}
+	}
+	if len(preferred) > 0 {
+		chosen := leastLoaded(req.Interfaces, preferred)
+		return chosen, fmt.Sprintf("interface is in preferred subnet %s", req.Interfaces[chosen].SubnetID), nil
+	}
+	chosen := leastLoaded(req.Interfaces, indexes)
+	return chosen, fmt.Sprintf("no interface in preferred subnets %v, fall back to subnet %s", subnets, req.Interfaces[chosen].SubnetID), nil
+}
+
+type macPinnedPicker struct {
+	basePicker
+}
+
+func newMACPinnedPicker(conf VPC) InterfacePicker {
+	return &macPinnedPicker{newBasePicker(conf)}
+}
+
+// Pick implements InterfacePicker
+func (p *macPinnedPicker) Pick(req *PickRequest) (int, string, error) {
+	if req.MAC == "" {
+		return -1, "", fmt.Errorf("VPC.API: MAC is required by policy %s", p.policy)
+	}
+	indexes, _ := p.candidates(req)
+	for _, idx := range indexes {
+		if strings.EqualFold(req.Interfaces[idx].MacAddress, req.MAC) {
+			return idx, fmt.Sprintf("interface is pinned by MAC %s", req.MAC), nil
+		}
+	}
+	return -1, "", &NoCapacityError{Policy: p.policy, Reason: fmt.Sprintf("interface with MAC %s is not found or full", req.MAC)}
+}
+
+func containsString(items []string, one string) bool {
+	for _, item := range items {
+		if item == one {
+			return true
+		}
+	}
+	return false
+}
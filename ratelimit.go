@@ -0,0 +1,168 @@
+package vpcapi
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RateLimitConfig defines how to limit API requests of Client, so bursts of CNI invocations won't overwhelm the API
+type RateLimitConfig struct {
+	// QPS is the rate of requests for each action, 0 means no limit
+	QPS float64 `json:"qps,omitempty"`
+	// Burst is the max number of requests of an action can be sent at once, default to 1
+	Burst int `json:"burst,omitempty"`
+	// ActionQPS overrides QPS for given actions, like {"AssignPrivateIpAddresses": 5}
+	ActionQPS map[string]float64 `json:"actionQPS,omitempty"`
+	// MaxInFlight is the max number of requests of Client waiting for response at the same time, 0 means no limit
+	MaxInFlight int `json:"maxInFlight,omitempty"`
+	// Node limits requests of all processes on the node, like CNI invocations for pods started at the same time
+	Node *NodeRateLimitConfig `json:"node,omitempty"`
+}
+
+// RateLimiter limits API requests. Wait blocks until request of given action can be sent, or ctx is done, release
+// must be called once the request is done.
+type RateLimiter interface {
+	Wait(ctx context.Context, action string) (release func(), err error)
+}
+
+// WithRateLimiter makes Client limit requests with given limiter, instead of the one based on rateLimit in config
+func WithRateLimiter(limiter RateLimiter) Option {
+	return func(c *Client) {
+		c.limiter = limiter
+	}
+}
+
+// NewRateLimiter creates a RateLimiter based on given config, nil is returned if conf is nil
+func NewRateLimiter(conf *RateLimitConfig) (RateLimiter, error) {
+	return newRateLimiter(conf, realClock{})
+}
+
+func newRateLimiter(conf *RateLimitConfig, clock Clock) (RateLimiter, error) {
+	if conf == nil {
+		return nil, nil
+	}
+	limiter := &clientRateLimiter{conf: *conf, clock: clock, buckets: map[string]*tokenBucket{}}
+	if conf.MaxInFlight > 0 {
+		limiter.inFlight = make(chan struct{}, conf.MaxInFlight)
+	}
+	if conf.Node != nil {
+		node, err := newNodeRateLimiter(*conf.Node, clock)
+		if err != nil {
+			return nil, err
+		}
+		limiter.node = node
+	}
+	return limiter, nil
+}
+
+// tokenBucket allows qps requests per second, and at most burst requests at once
+type tokenBucket struct {
+	mutex  sync.Mutex
+	qps    float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// reserve takes a token, and returns how long to wait before the token is available
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.last.IsZero() {
+		b.tokens = b.burst
+	} else if now.After(b.last) {
+		b.tokens += now.Sub(b.last).Seconds() * b.qps
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	if now.After(b.last) {
+		b.last = now
+	}
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.qps * float64(time.Second))
+}
+
+// cancel gives back a reserved token which is not used
+func (b *tokenBucket) cancel() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.tokens++
+}
+
+// clientRateLimiter limits requests by token bucket per action, and max in-flight requests, then by node limiter
+type clientRateLimiter struct {
+	conf     RateLimitConfig
+	clock    Clock
+	inFlight chan struct{}
+	node     *nodeRateLimiter
+
+	mutex   sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+func (l *clientRateLimiter) bucket(action string) *tokenBucket {
+	qps, ok := l.conf.ActionQPS[action]
+	if !ok {
+		qps = l.conf.QPS
+	}
+	if qps <= 0 {
+		return nil
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	bucket, ok := l.buckets[action]
+	if !ok {
+		burst := float64(l.conf.Burst)
+		if burst < 1 {
+			burst = 1
+		}
+		bucket = &tokenBucket{qps: qps, burst: burst}
+		l.buckets[action] = bucket
+	}
+	return bucket
+}
+
+// Wait implements RateLimiter
+func (l *clientRateLimiter) Wait(ctx context.Context, action string) (func(), error) {
+	if bucket := l.bucket(action); bucket != nil {
+		if delay := bucket.reserve(l.clock.Now()); delay > 0 {
+			select {
+			case <-ctx.Done():
+				bucket.cancel()
+				return nil, ctx.Err()
+			case <-l.clock.After(delay):
+			}
+		}
+	}
+	if l.inFlight != nil {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case l.inFlight <- struct{}{}:
+		}
+	}
+	release := func() {
+		if l.inFlight != nil {
+			<-l.inFlight
+		}
+	}
+	if l.node != nil {
+		releaseNode, err := l.node.Wait(ctx, action)
+		if err != nil {
+			release()
+			return nil, fmt.Errorf("VPC.API: failed to wait for node rate limiter, since: %w", err)
+		}
+		releaseClient := release
+		release = func() {
+			releaseNode()
+			releaseClient()
+		}
+	}
+	return release, nil
+}
@@ -0,0 +1,131 @@
+package vpcapi
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// nodeLockPollInterval is the interval to try file locks held by other processes again
+const nodeLockPollInterval = 20 * time.Millisecond
+
+// NodeRateLimitConfig defines rate limit shared by all processes on the node with file locks in Dir, processes
+// cooperate as long as they use the same Dir
+type NodeRateLimitConfig struct {
+	// Dir is the directory of lock files, like "/var/run/vpcapi", it's created if not exists
+	Dir string `json:"dir"`
+	// QPS is the rate of requests of all actions on the node, 0 means no limit
+	QPS float64 `json:"qps,omitempty"`
+	// MaxInFlight is the max number of requests waiting for response on the node at the same time, 0 means no limit
+	MaxInFlight int `json:"maxInFlight,omitempty"`
+}
+
+// nodeRateLimiter limits requests of processes on the node. For QPS, the time of last request is recorded in file
+// "rate", and requests are spaced by 1/QPS under its lock; for MaxInFlight, each request holds lock of one of files
+// "inflight.<N>" until it's done.
+type nodeRateLimiter struct {
+	conf  NodeRateLimitConfig
+	clock Clock
+}
+
+func newNodeRateLimiter(conf NodeRateLimitConfig, clock Clock) (*nodeRateLimiter, error) {
+	if conf.Dir == "" {
+		return nil, fmt.Errorf("VPC.API: dir is required by node rate limit")
+	}
+	if err := fileLockSupported(); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(conf.Dir, 0700); err != nil {
+		return nil, fmt.Errorf("VPC.API: failed to create dir %s for node rate limit, since: %v", conf.Dir, err)
+	}
+	return &nodeRateLimiter{conf: conf, clock: clock}, nil
+}
+
+// Wait implements RateLimiter
+func (l *nodeRateLimiter) Wait(ctx context.Context, action string) (func(), error) {
+	if l.conf.QPS > 0 {
+		if err := l.waitRate(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if l.conf.MaxInFlight <= 0 {
+		return func() {}, nil
+	}
+	slot, err := l.acquireSlot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		unlockFile(slot)
+		slot.Close()
+	}, nil
+}
+
+// lock opens given file and locks it, it polls until lock is acquired or ctx is done
+func (l *nodeRateLimiter) lock(ctx context.Context, name string) (*os.File, error) {
+	for {
+		file, ok, err := tryLockFile(filepath.Join(l.conf.Dir, name))
+		if err != nil || ok {
+			return file, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-l.clock.After(nodeLockPollInterval):
+		}
+	}
+}
+
+// waitRate waits until 1/QPS passed since the last request on the node, and records time of this request
+func (l *nodeRateLimiter) waitRate(ctx context.Context) error {
+	file, err := l.lock(ctx, "rate")
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	defer unlockFile(file)
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return err
+	}
+	interval := time.Duration(float64(time.Second) / l.conf.QPS)
+	if last, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64); err == nil {
+		if delay := time.Unix(0, last).Add(interval).Sub(l.clock.Now()); delay > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-l.clock.After(delay):
+			}
+		}
+	}
+	if err := file.Truncate(0); err != nil {
+		return err
+	}
+	_, err = file.WriteAt([]byte(strconv.FormatInt(l.clock.Now().UnixNano(), 10)), 0)
+	return err
+}
+
+// acquireSlot locks one of in-flight slot files, it polls until a slot is free or ctx is done
+func (l *nodeRateLimiter) acquireSlot(ctx context.Context) (*os.File, error) {
+	for {
+		for i := 0; i < l.conf.MaxInFlight; i++ {
+			file, ok, err := tryLockFile(filepath.Join(l.conf.Dir, fmt.Sprintf("inflight.%d", i)))
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				return file, nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-l.clock.After(nodeLockPollInterval):
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package vpcapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// errMigrateNotDetected is returned when migrated IP is not detected on new interface after post check
+var errMigrateNotDetected = errors.New("VPC.API: ip failed to migrate to new interface")
+
+// RetryPolicy defines exponential backoff with jitter for retrying operations like assign, release and migrate IP.
+// Durations are in milliseconds. Delay before No.n retry is min(Max, Base * Multiplier^(n-1)), and then randomized
+// within [delay*(1-Jitter), delay*(1+Jitter)].
+type RetryPolicy struct {
+	// MaxAttempts limits attempts, if not set, retry of operation like ipAssign.retry is used
+	MaxAttempts int     `json:"maxAttempts,omitempty"`
+	Base        int     `json:"base,omitempty"`
+	Max         int     `json:"max,omitempty"`
+	Multiplier  float64 `json:"multiplier,omitempty"`
+	Jitter      float64 `json:"jitter,omitempty"`
+	// MaxElapsed stops retrying once next attempt will start after MaxElapsed since the first attempt
+	MaxElapsed int `json:"maxElapsed,omitempty"`
+}
+
+// backoff returns delay after given number of failed attempts
+func (p RetryPolicy) backoff(failed int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	delay := float64(p.Base) * math.Pow(multiplier, float64(failed-1))
+	if p.Max > 0 && delay > float64(p.Max) {
+		delay = float64(p.Max)
+	}
+	if p.Jitter > 0 {
+		jitter := math.Min(p.Jitter, 1)
+		delay = delay * (1 - jitter + 2*jitter*rand.Float64())
+	}
+	return time.Duration(delay * float64(time.Millisecond))
+}
+
+// RetryError is returned when operation still fails after retries, or fails with an error not retryable
+type RetryError struct {
+	Attempts int
+	Err      error
+}
+
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("VPC.API: failed after %d attempts, since: %v", e.Attempts, e.Err)
+}
+
+// Unwrap returns the error of last attempt
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+// IsRetryable tells whether err is transient, like resource busy, network failures and server side errors
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	// request timeout is retryable, while caller's ctx done is not
+	if IsTimeout(err) {
+		return true
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	// open circuit breaker means the endpoint is degraded, fail fast rather than retry
+	if IsCircuitOpen(err) {
+		return false
+	}
+	statusErr := &HTTPStatusError{}
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= http.StatusInternalServerError || statusErr.StatusCode == http.StatusTooManyRequests
+	}
+	if errors.Is(err, errMigrateNotDetected) {
+		return true
+	}
+	if apiErr, ok := asAPIError(err); ok {
+		return IsResourceBusy(err) ||
+			apiErr.HTTPStatus >= http.StatusInternalServerError ||
+			apiErr.HTTPStatus == http.StatusTooManyRequests ||
+			strings.HasPrefix(apiErr.CodeDesc, "InternalError") ||
+			strings.HasPrefix(apiErr.CodeDesc, "RequestLimitExceeded")
+	}
+	return isTransientNetError(err)
+}
+
+// isTransientNetError tells whether err is a network failure that may succeed if retried, like timeouts and connection
+// reset. Permanent failures, like certificate verification, invalid proxy URL or unsupported scheme, are not.
+func isTransientNetError(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && (netErr.Timeout() || netErr.Temporary()) {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNABORTED) || errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+}
+
+// getRetryPolicy returns the shared retry policy in config, or a fixed interval policy based on given retry and
+// interval of the operation
+func (c *Client) getRetryPolicy(retry, interval int) RetryPolicy {
+	if c.conf.RetryPolicy == nil {
+		return RetryPolicy{MaxAttempts: retry, Base: interval, Multiplier: 1}
+	}
+	policy := *c.conf.RetryPolicy
+	if policy.MaxAttempts == 0 {
+		policy.MaxAttempts = retry
+	}
+	return policy
+}
+
+// retry calls fn with attempt index until it succeeds, fails with error not retryable, or policy exhausted
+func (c *Client) retry(ctx context.Context, policy RetryPolicy, fn func(attempt int) error) error {
+	if policy.MaxAttempts <= 0 && policy.MaxElapsed <= 0 {
+		policy.MaxAttempts = 1
+	}
+	start := c.clock.Now()
+	attempts := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		err := fn(attempts)
+		attempts++
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !IsRetryable(err) {
+			return &RetryError{Attempts: attempts, Err: err}
+		}
+		if policy.MaxAttempts > 0 && attempts >= policy.MaxAttempts {
+			return &RetryError{Attempts: attempts, Err: err}
+		}
+		delay := policy.backoff(attempts)
+		if policy.MaxElapsed > 0 && c.clock.Now().Sub(start)+delay > time.Duration(policy.MaxElapsed)*time.Millisecond {
+			return &RetryError{Attempts: attempts, Err: err}
+		}
+		c.logger.Printf("VPC.API: attempt %d failed with: %v, retry after %v", attempts, err, delay)
+		if err := c.sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package vpcapi
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+)
+
+type timeoutNetError struct{}
+
+func (timeoutNetError) Error() string   { return "i/o timeout" }
+func (timeoutNetError) Timeout() bool   { return true }
+func (timeoutNetError) Temporary() bool { return true }
+
+func TestIsRetryable(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "request timeout", err: &TimeoutError{Action: "AssignPrivateIpAddresses"}, want: true},
+		{name: "ctx canceled", err: context.Canceled, want: false},
+		{name: "circuit open", err: &CircuitOpenError{Action: "AssignPrivateIpAddresses"}, want: false},
+		{name: "bad gateway", err: &HTTPStatusError{StatusCode: 502}, want: true},
+		{name: "bad request", err: &HTTPStatusError{StatusCode: 400}, want: false},
+		{name: "internal error", err: &APIError{CodeDesc: "InternalError"}, want: true},
+		{name: "invalid parameter", err: &APIError{CodeDesc: "InvalidParameter"}, want: false},
+		{
+			name: "net timeout",
+			err:  &url.Error{Op: "Get", URL: "https://localhost", Err: &net.OpError{Op: "dial", Err: timeoutNetError{}}},
+			want: true,
+		},
+		{
+			name: "connection reset",
+			err: &url.Error{Op: "Get", URL: "https://localhost", Err: &net.OpError{Op: "read",
+				Err: &os.SyscallError{Syscall: "read", Err: syscall.ECONNRESET}}},
+			want: true,
+		},
+		{name: "connection closed", err: &url.Error{Op: "Get", URL: "https://localhost", Err: io.EOF}, want: true},
+		{
+			name: "unknown authority",
+			err:  &url.Error{Op: "Get", URL: "https://localhost", Err: x509.UnknownAuthorityError{}},
+			want: false,
+		},
+		{
+			name: "unsupported scheme",
+			err:  &url.Error{Op: "Get", URL: "ftp://localhost", Err: errors.New("unsupported protocol scheme \"ftp\"")},
+			want: false,
+		},
+		{
+			name: "wrapped",
+			err:  fmt.Errorf("VPC.API: AssignPrivateIpAddresses doRequest failed with: %w", &HTTPStatusError{StatusCode: 503}),
+			want: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := IsRetryable(c.err); got != c.want {
+				t.Errorf("IsRetryable(%v) = %v, want %v", c.err, got, c.want)
+			}
+		})
+	}
+}
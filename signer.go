@@ -0,0 +1,392 @@
+package vpcapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// SignatureMethodHmacSHA1 is the signature method for v2 API, request params are signed and sent as url query
+	SignatureMethodHmacSHA1 = "HmacSHA1"
+	// SignatureMethodTC3HmacSHA256 is the signature method for API 3.0, request params are sent as JSON body with POST,
+	// and signature is sent with header Authorization
+	SignatureMethodTC3HmacSHA256 = "TC3-HMAC-SHA256"
+
+	defaultRequestClient = "vpcapi"
+	tc3Request           = "tc3_request"
+	tc3ContentType       = "application/json; charset=utf-8"
+	tc3SignedHeaders     = "content-type;host"
+	// v2Service is the service whose requests are v2 API, params and responses of it aren't in API 3.0 schema
+	v2Service = "vpc"
+)
+
+// tc3IntegerParams are params sent as JSON numbers by TC3Signer, others are sent as strings
+var tc3IntegerParams = map[string]bool{
+	"Offset":          true,
+	"Limit":           true,
+	"DurationSeconds": true,
+}
+
+// Signer builds a signed http request for cloud API with given endpoint and request params. Besides of action
+// specified params, params contains "Action", "Version" and "Service", and it's up to signer to decide how to send
+// them.
+type Signer interface {
+	Sign(endpoint string, params map[string]string) (*http.Request, error)
+}
+
+// ContextSigner is implemented by signers which may wait for credential, so callers can give up when ctx is done
+type ContextSigner interface {
+	Signer
+	SignContext(ctx context.Context, endpoint string, params map[string]string) (*http.Request, error)
+}
+
+// NewSigner creates a signer based on signature method in given vpc config, HmacSHA1 is used if not set. With
+// TC3-HMAC-SHA256, only requests of API 3.0 services are signed by it, and v2 vpc requests are still signed by
+// HmacSHA1. Credential is provided by NewCredentialProvider with default http client and metadata client.
+func NewSigner(conf VPC) (Signer, error) {
+	credentials, err := NewCredentialProvider(conf, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return newSigner(conf, realClock{}, credentials)
+}
+
+func newSigner(conf VPC, clock Clock, credentials CredentialProvider) (Signer, error) {
+	switch conf.SignatureMethod {
+	case "", SignatureMethodHmacSHA1:
+		return &HmacSHA1Signer{
+			SecretID:      conf.SecretID,
+			SecretKey:     conf.SecretKey,
+			Credentials:   credentials,
+			Region:        conf.Region,
+			RequestClient: conf.RequestClient,
+			Clock:         clock,
+		}, nil
+	case SignatureMethodTC3HmacSHA256:
+		// requests of vpc service are v2 API, which can't be signed by TC3-HMAC-SHA256, so they keep HmacSHA1
+		return &serviceSigner{
+			v2: &HmacSHA1Signer{
+				SecretID:      conf.SecretID,
+				SecretKey:     conf.SecretKey,
+				Credentials:   credentials,
+				Region:        conf.Region,
+				RequestClient: conf.RequestClient,
+				Clock:         clock,
+			},
+			v3: &TC3Signer{
+				SecretID:    conf.SecretID,
+				SecretKey:   conf.SecretKey,
+				Credentials: credentials,
+				Region:      conf.Region,
+				Clock:       clock,
+			},
+		}, nil
+	default:
+		return nil, fmt.Errorf("VPC.API: unsupported signature method %s", conf.SignatureMethod)
+	}
+}
+
+// serviceSigner signs requests of v2 service with v2 signer, and requests of other services, like cvm and sts, with
+// v3 signer
+type serviceSigner struct {
+	v2 ContextSigner
+	v3 ContextSigner
+}
+
+// Sign implements Signer
+func (s *serviceSigner) Sign(endpoint string, params map[string]string) (*http.Request, error) {
+	return s.SignContext(context.Background(), endpoint, params)
+}
+
+// SignContext implements ContextSigner
+func (s *serviceSigner) SignContext(ctx context.Context, endpoint string, params map[string]string) (*http.Request, error) {
+	if params["Service"] == v2Service {
+		return s.v2.SignContext(ctx, endpoint, params)
+	}
+	return s.v3.SignContext(ctx, endpoint, params)
+}
+
+// HmacSHA1Signer signs requests with HmacSHA1, the signature method for v2 API. If Credentials is set, SecretID and
+// SecretKey are ignored, and token of temporary credential is sent as param Token.
+type HmacSHA1Signer struct {
+	SecretID      string
+	SecretKey     string
+	Credentials   CredentialProvider
+	Region        string
+	RequestClient string
+	Clock         Clock
+}
+
+func (s *HmacSHA1Signer) getKeys() []string {
+	return []string{"Nonce", "Region", "SecretId", "Timestamp", "SignatureMethod", "RequestClient"}
+}
+
+func (s *HmacSHA1Signer) getValue(k string) string {
+	switch k {
+	case "SecretId":
+		return s.SecretID
+	case "Region":
+		return s.Region
+	case "Nonce":
+		return strconv.Itoa(rand.Int())
+	case "Timestamp":
+		return strconv.FormatInt(s.Clock.Now().Unix(), 10)
+	case "SignatureMethod":
+		return SignatureMethodHmacSHA1
+	case "RequestClient":
+		if s.RequestClient != "" {
+			return s.RequestClient
+		}
+		return defaultRequestClient
+	default:
+		return ""
+	}
+}
+
+// mergeKeys fills common params, params already set like Nonce and Timestamp will be kept
+func (s *HmacSHA1Signer) mergeKeys(params map[string]string) {
+	for _, k := range s.getKeys() {
+		if v, ok := params[k]; !ok || v == "" {
+			params[k] = s.getValue(k)
+		}
+	}
+}
+
+// Signature returns the raw(not escaped) signature of given params
+func (s *HmacSHA1Signer) Signature(requestMethod, endpoint string, params map[string]string) string {
+	keys := []string{}
+	for k := range params {
+		if k != "Signature" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	reqStrs := []string{}
+	for _, k := range keys {
+		reqStrs = append(reqStrs, fmt.Sprintf("%s=%s", k, params[k]))
+	}
+
+	reqStr := strings.Join(reqStrs, "&")
+	signReqStr := fmt.Sprintf("%s%s?%s", requestMethod, endpoint, reqStr)
+	hashed := hmac.New(sha1.New, []byte(s.SecretKey))
+	hashed.Write([]byte(signReqStr))
+	return base64.StdEncoding.EncodeToString(hashed.Sum(nil))
+}
+
+// Sign implements Signer
+func (s *HmacSHA1Signer) Sign(endpoint string, params map[string]string) (*http.Request, error) {
+	return s.SignContext(context.Background(), endpoint, params)
+}
+
+// SignContext implements ContextSigner
+func (s *HmacSHA1Signer) SignContext(ctx context.Context, endpoint string, params map[string]string) (*http.Request, error) {
+	requestMethod := "GET"
+	delete(params, "Service")
+	cred, err := getCredential(ctx, s.Credentials, s.SecretID, s.SecretKey)
+	if err != nil {
+		return nil, err
+	}
+	signer := *s
+	signer.SecretID, signer.SecretKey = cred.SecretID, cred.SecretKey
+	if cred.Token != "" {
+		params["Token"] = cred.Token
+	}
+	signer.mergeKeys(params)
+	params["Signature"] = url.QueryEscape(signer.Signature(requestMethod, endpoint, params))
+
+	req, err := http.NewRequest(requestMethod, "https://"+endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	setReqQuery(params, req)
+	return req, nil
+}
+
+// TC3Signer signs requests with TC3-HMAC-SHA256, the signature method for API 3.0. If Credentials is set, SecretID
+// and SecretKey are ignored, and token of temporary credential is sent with header X-TC-Token. Requests of v2 API,
+// like those of service vpc, are refused, since their params and responses aren't in API 3.0 schema.
+type TC3Signer struct {
+	SecretID    string
+	SecretKey   string
+	Credentials CredentialProvider
+	Region      string
+	Clock       Clock
+}
+
+func hmacSHA256(key []byte, msg string) []byte {
+	hashed := hmac.New(sha256.New, key)
+	hashed.Write([]byte(msg))
+	return hashed.Sum(nil)
+}
+
+func sha256Hex(msg []byte) string {
+	sum := sha256.Sum256(msg)
+	return hex.EncodeToString(sum[:])
+}
+
+// Authorization returns value of header Authorization for given request attributes
+func (s *TC3Signer) Authorization(service, host, path string, timestamp int64, payload []byte) string {
+	canonicalRequest := strings.Join([]string{
+		"POST",
+		path,
+		"",
+		fmt.Sprintf("content-type:%s\nhost:%s\n", tc3ContentType, host),
+		tc3SignedHeaders,
+		sha256Hex(payload),
+	}, "\n")
+	date := time.Unix(timestamp, 0).UTC().Format("2006-01-02")
+	credentialScope := fmt.Sprintf("%s/%s/%s", date, service, tc3Request)
+	stringToSign := strings.Join([]string{
+		SignatureMethodTC3HmacSHA256,
+		strconv.FormatInt(timestamp, 10),
+		credentialScope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	secretDate := hmacSHA256([]byte("TC3"+s.SecretKey), date)
+	secretService := hmacSHA256(secretDate, service)
+	secretSigning := hmacSHA256(secretService, tc3Request)
+	signature := hex.EncodeToString(hmacSHA256(secretSigning, stringToSign))
+	return fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		SignatureMethodTC3HmacSHA256, s.SecretID, credentialScope, tc3SignedHeaders, signature)
+}
+
+// Sign implements Signer
+func (s *TC3Signer) Sign(endpoint string, params map[string]string) (*http.Request, error) {
+	return s.SignContext(context.Background(), endpoint, params)
+}
+
+// SignContext implements ContextSigner
+func (s *TC3Signer) SignContext(ctx context.Context, endpoint string, params map[string]string) (*http.Request, error) {
+	action := params["Action"]
+	version := params["Version"]
+	service := params["Service"]
+	region := params["Region"]
+	if region == "" {
+		region = s.Region
+	}
+	for _, k := range []string{"Action", "Version", "Service", "Region"} {
+		delete(params, k)
+	}
+	if service == "" {
+		return nil, fmt.Errorf("VPC.API: service is required by %s", SignatureMethodTC3HmacSHA256)
+	}
+	if service == v2Service {
+		return nil, fmt.Errorf("VPC.API: %s of service %s is v2 API, which is not supported by %s", action, service, SignatureMethodTC3HmacSHA256)
+	}
+	cred, err := getCredential(ctx, s.Credentials, s.SecretID, s.SecretKey)
+	if err != nil {
+		return nil, err
+	}
+	signer := *s
+	signer.SecretID, signer.SecretKey = cred.SecretID, cred.SecretKey
+
+	body, err := unflattenParams(params)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", "https://"+endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	path := req.URL.Path
+	if path == "" {
+		path = "/"
+	}
+	timestamp := s.Clock.Now().Unix()
+	req.Header.Set("Content-Type", tc3ContentType)
+	req.Header.Set("X-TC-Action", action)
+	req.Header.Set("X-TC-Version", version)
+	req.Header.Set("X-TC-Timestamp", strconv.FormatInt(timestamp, 10))
+	if region != "" {
+		req.Header.Set("X-TC-Region", region)
+	}
+	if cred.Token != "" {
+		req.Header.Set("X-TC-Token", cred.Token)
+	}
+	req.Header.Set("Authorization", signer.Authorization(service, req.URL.Host, path, timestamp, payload))
+	return req, nil
+}
+
+// unflattenParams converts flat params like "Filters.0.Values.0" into nested JSON objects and arrays for API 3.0,
+// values of params in tc3IntegerParams are converted to JSON numbers.
+func unflattenParams(params map[string]string) (map[string]interface{}, error) {
+	root := map[string]interface{}{}
+	for k, v := range params {
+		parts := strings.Split(k, ".")
+		node := root
+		for i, part := range parts {
+			if i == len(parts)-1 {
+				if _, ok := node[part]; ok {
+					return nil, fmt.Errorf("VPC.API: param %s conflicts with other params", k)
+				}
+				if !tc3IntegerParams[part] {
+					node[part] = v
+					break
+				}
+				n, err := strconv.ParseInt(v, 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("VPC.API: param %s should be an integer, but got %s", k, v)
+				}
+				node[part] = n
+				break
+			}
+			child, ok := node[part]
+			if !ok {
+				child = map[string]interface{}{}
+				node[part] = child
+			}
+			childNode, ok := child.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("VPC.API: param %s conflicts with other params", k)
+			}
+			node = childNode
+		}
+	}
+	for k, v := range root {
+		root[k] = toJSONArrays(v)
+	}
+	return root, nil
+}
+
+// toJSONArrays converts objects whose keys are 0...n-1 into arrays
+func toJSONArrays(node interface{}) interface{} {
+	obj, ok := node.(map[string]interface{})
+	if !ok {
+		return node
+	}
+	for k, v := range obj {
+		obj[k] = toJSONArrays(v)
+	}
+	items := make([]interface{}, len(obj))
+	for k, v := range obj {
+		idx, err := strconv.Atoi(k)
+		if err != nil || idx < 0 || idx >= len(obj) {
+			return obj
+		}
+		items[idx] = v
+	}
+	if len(items) == 0 {
+		return obj
+	}
+	return items
+}
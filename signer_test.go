@@ -0,0 +1,258 @@
+package vpcapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Secret ID and key of examples in the signature docs of cloud API
+const (
+	exampleSecretID  = "AKIDz8krbsJ5yKBZQpn74WFkmLPx3EXAMPLE"
+	exampleSecretKey = "Gu5t9xGARNpq86cd98joQYCN3EXAMPLE"
+)
+
+type fixedClock struct {
+	now time.Time
+}
+
+func (c fixedClock) Now() time.Time {
+	return c.now
+}
+
+func (c fixedClock) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	ch <- c.now.Add(d)
+	return ch
+}
+
+func TestHmacSHA1SignerSignature(t *testing.T) {
+	signer := &HmacSHA1Signer{SecretID: exampleSecretID, SecretKey: exampleSecretKey}
+	params := map[string]string{
+		"Action":        "DescribeInstances",
+		"InstanceIds.0": "ins-09dx96dg",
+		"Limit":         "20",
+		"Nonce":         "11886",
+		"Offset":        "0",
+		"Region":        "ap-guangzhou",
+		"SecretId":      exampleSecretID,
+		"Timestamp":     "1465185768",
+		"Version":       "2017-03-12",
+		// Signature itself is not signed
+		"Signature": "ignored",
+	}
+	got := signer.Signature("GET", "cvm.tencentcloudapi.com/", params)
+	if want := "EliP9YW3pW28FpsEdkXt/+WcGeI="; got != want {
+		t.Errorf("Signature() = %s, want %s", got, want)
+	}
+}
+
+func TestHmacSHA1SignerSign(t *testing.T) {
+	now := time.Unix(1465185768, 0)
+	signer := &HmacSHA1Signer{SecretID: exampleSecretID, SecretKey: exampleSecretKey, Region: "ap-guangzhou", Clock: fixedClock{now: now}}
+	params := map[string]string{"Action": "DescribeNetworkInterfaces", "Service": "vpc", "Nonce": "11886"}
+	req, err := signer.Sign("vpc.api.qcloud.com/v2/index.php", params)
+	if err != nil {
+		t.Fatalf("Sign() failed, since: %v", err)
+	}
+	query := req.URL.Query()
+	for k, want := range map[string]string{
+		"Action":          "DescribeNetworkInterfaces",
+		"Nonce":           "11886",
+		"Timestamp":       "1465185768",
+		"SecretId":        exampleSecretID,
+		"Region":          "ap-guangzhou",
+		"SignatureMethod": SignatureMethodHmacSHA1,
+		"RequestClient":   defaultRequestClient,
+	} {
+		if got := query.Get(k); got != want {
+			t.Errorf("param %s = %s, want %s", k, got, want)
+		}
+	}
+	if _, ok := query["Service"]; ok {
+		t.Errorf("param Service should not be sent")
+	}
+	if query.Get("Signature") == "" {
+		t.Errorf("param Signature is not set")
+	}
+}
+
+func TestTC3SignerAuthorization(t *testing.T) {
+	signer := &TC3Signer{SecretID: exampleSecretID, SecretKey: exampleSecretKey}
+	// payload of the DescribeInstances example in the doc, non-ASCII characters are escaped like python json.dumps
+	payload := `{"Limit": 1, "Filters": [{"Values": ["\u672a\u547d\u540d"], "Name": "instance-name"}]}`
+	if got, want := sha256Hex([]byte(payload)), "35e9c5b0e3ae67532d3c9f17ead6c90222632e5b1ff7f6e89887f1398934f064"; got != want {
+		t.Fatalf("hashed payload = %s, want %s", got, want)
+	}
+	// signature is cross-checked with python hashlib and hmac, following the steps in the doc
+	got := signer.Authorization("cvm", "cvm.tencentcloudapi.com", "/", 1551113065, []byte(payload))
+	want := "TC3-HMAC-SHA256 Credential=AKIDz8krbsJ5yKBZQpn74WFkmLPx3EXAMPLE/2019-02-25/cvm/tc3_request, " +
+		"SignedHeaders=content-type;host, " +
+		"Signature=72e494ea809ad7a8c8f7a4507b9bddcbaa8e581f516e8da2f66e2c5a96525168"
+	if got != want {
+		t.Errorf("Authorization() = %s, want %s", got, want)
+	}
+}
+
+func TestTC3SignerSign(t *testing.T) {
+	now := time.Unix(1551113065, 0)
+	signer := &TC3Signer{SecretID: exampleSecretID, SecretKey: exampleSecretKey, Region: "ap-guangzhou", Clock: fixedClock{now: now}}
+	params := map[string]string{
+		"Action":  "DescribeInstances",
+		"Version": "2017-03-12",
+		"Service": "cvm",
+		"Limit":   "1",
+	}
+	req, err := signer.Sign("cvm.tencentcloudapi.com", params)
+	if err != nil {
+		t.Fatalf("Sign() failed, since: %v", err)
+	}
+	for k, want := range map[string]string{
+		"Content-Type":   tc3ContentType,
+		"X-TC-Action":    "DescribeInstances",
+		"X-TC-Version":   "2017-03-12",
+		"X-TC-Timestamp": "1551113065",
+		"X-TC-Region":    "ap-guangzhou",
+	} {
+		if got := req.Header.Get(k); got != want {
+			t.Errorf("header %s = %s, want %s", k, got, want)
+		}
+	}
+	payload := []byte(`{"Limit":1}`)
+	if want := signer.Authorization("cvm", "cvm.tencentcloudapi.com", "/", now.Unix(), payload); req.Header.Get("Authorization") != want {
+		t.Errorf("header Authorization = %s, want %s", req.Header.Get("Authorization"), want)
+	}
+
+	vpcParams := map[string]string{"Action": "DescribeNetworkInterfaces", "Version": "2017-03-12", "Service": "vpc"}
+	if _, err := signer.Sign("vpc.api.qcloud.com/v2/index.php", vpcParams); err == nil {
+		t.Errorf("Sign() of v2 vpc API should fail")
+	}
+}
+
+func TestUnflattenParams(t *testing.T) {
+	cases := []struct {
+		name    string
+		params  map[string]string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "flat",
+			params: map[string]string{"RoleArn": "qcs::cam::uin/1:roleName/foo", "DurationSeconds": "7200"},
+			want:   `{"DurationSeconds":7200,"RoleArn":"qcs::cam::uin/1:roleName/foo"}`,
+		},
+		{
+			name:   "integer-like string is kept",
+			params: map[string]string{"InstanceName": "123", "Limit": "20", "Offset": "0"},
+			want:   `{"InstanceName":"123","Limit":20,"Offset":0}`,
+		},
+		{
+			name: "nested arrays",
+			params: map[string]string{
+				"Filters.0.Name":     "private-ip-address",
+				"Filters.0.Values.0": "10.0.0.1",
+				"Filters.0.Values.1": "10.0.0.2",
+				"Filters.1.Name":     "zone",
+				"Filters.1.Values.0": "ap-guangzhou-3",
+			},
+			want: `{"Filters":[{"Name":"private-ip-address","Values":["10.0.0.1","10.0.0.2"]},` +
+				`{"Name":"zone","Values":["ap-guangzhou-3"]}]}`,
+		},
+		{
+			name:   "sparse indexes stay object",
+			params: map[string]string{"InstanceIds.0": "ins-1", "InstanceIds.2": "ins-2"},
+			want:   `{"InstanceIds":{"0":"ins-1","2":"ins-2"}}`,
+		},
+		{
+			name:    "conflict",
+			params:  map[string]string{"Filters": "foo", "Filters.0.Name": "zone"},
+			wantErr: true,
+		},
+		{
+			name:    "non-integer value of integer param",
+			params:  map[string]string{"Limit": "ten"},
+			wantErr: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := unflattenParams(c.params)
+			if c.wantErr {
+				if err == nil {
+					t.Errorf("unflattenParams() should fail, but got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unflattenParams() failed, since: %v", err)
+			}
+			data, err := json.Marshal(got)
+			if err != nil {
+				t.Fatalf("failed to marshal %v, since: %v", got, err)
+			}
+			if string(data) != c.want {
+				t.Errorf("unflattenParams() = %s, want %s", data, c.want)
+			}
+		})
+	}
+}
+
+func TestToJSONArrays(t *testing.T) {
+	cases := []struct {
+		name string
+		node interface{}
+		want interface{}
+	}{
+		{name: "scalar", node: "foo", want: "foo"},
+		{name: "empty object", node: map[string]interface{}{}, want: map[string]interface{}{}},
+		{
+			name: "indexes",
+			node: map[string]interface{}{"1": "b", "0": "a"},
+			want: []interface{}{"a", "b"},
+		},
+		{
+			name: "non-index key",
+			node: map[string]interface{}{"0": "a", "Name": "b"},
+			want: map[string]interface{}{"0": "a", "Name": "b"},
+		},
+		{
+			name: "nested",
+			node: map[string]interface{}{"0": map[string]interface{}{"0": "a"}},
+			want: []interface{}{[]interface{}{"a"}},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := toJSONArrays(c.node); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("toJSONArrays() = %#v, want %#v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestNewSignerTC3(t *testing.T) {
+	now := time.Unix(1551113065, 0)
+	conf := VPC{SecretID: exampleSecretID, SecretKey: exampleSecretKey, Region: "ap-guangzhou", SignatureMethod: SignatureMethodTC3HmacSHA256}
+	signer, err := newSigner(conf, fixedClock{now: now}, nil)
+	if err != nil {
+		t.Fatalf("newSigner() failed, since: %v", err)
+	}
+	cvmParams := map[string]string{"Action": "DescribeInstances", "Version": "2017-03-12", "Service": "cvm"}
+	req, err := signer.Sign("cvm.tencentcloudapi.com", cvmParams)
+	if err != nil {
+		t.Fatalf("Sign() of cvm request failed, since: %v", err)
+	}
+	if req.Method != "POST" || req.Header.Get("X-TC-Action") != "DescribeInstances" {
+		t.Errorf("cvm request should be signed by %s, got %s %v", SignatureMethodTC3HmacSHA256, req.Method, req.Header)
+	}
+
+	vpcParams := map[string]string{"Action": "DescribeNetworkInterfaces", "Service": "vpc"}
+	req, err = signer.Sign("vpc.api.qcloud.com/v2/index.php", vpcParams)
+	if err != nil {
+		t.Fatalf("Sign() of vpc request failed, since: %v", err)
+	}
+	if got := req.URL.Query().Get("SignatureMethod"); req.Method != "GET" || got != SignatureMethodHmacSHA1 {
+		t.Errorf("vpc request should be signed by %s, got %s %s", SignatureMethodHmacSHA1, req.Method, got)
+	}
+}
@@ -0,0 +1,83 @@
+package vpcapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// subnetsPageLimit is the max limit of one DescribeSubnets request
+const subnetsPageLimit = 100
+
+// DescribeSubnets gets subnets in vpc by given subnet IDs, all subnets in vpc are returned if subnetIDs is empty
+func (c *Client) DescribeSubnets(ctx context.Context, subnetIDs []string) ([]DescribeSubnetsSubnet, error) {
+	subnets := []DescribeSubnetsSubnet{}
+	for offset := 0; ; {
+		params := getBaseParams("DescribeSubnets", c.conf.VPCID)
+		for idx, subnetID := range subnetIDs {
+			params[fmt.Sprintf("subnetIds.%d", idx)] = subnetID
+		}
+		params["offset"] = strconv.Itoa(offset)
+		params["limit"] = strconv.Itoa(subnetsPageLimit)
+		resp, err := c.doRequest(ctx, params)
+		if err != nil {
+			return nil, fmt.Errorf("VPC.API: DescribeSubnets doRequest failed with: %w", err)
+		}
+		subnetsResp := &DescribeSubnetsResponse{}
+		if err := json.Unmarshal(resp, subnetsResp); err != nil {
+			return nil, fmt.Errorf("VPC.API: DescribeSubnets failed to do json unmarshal, since: %v", err)
+		}
+		page := subnetsResp.Data.Data
+		subnets = append(subnets, page...)
+		offset += len(page)
+		if isLastPage(len(page), subnetsPageLimit, offset, subnetsResp.Data.TotalNum) {
+			return subnets, nil
+		}
+	}
+}
+
+// GetSubnetAvailableIPs returns number of available IPs keyed by subnet ID, for subnets of given interfaces
+func (c *Client) GetSubnetAvailableIPs(ctx context.Context, interfaces []DescribeInterfacesNetworkInterface) (map[string]int, error) {
+	subnetIDs := []string{}
+	for _, intf := range interfaces {
+		if intf.SubnetID != "" && !containsString(subnetIDs, intf.SubnetID) {
+			subnetIDs = append(subnetIDs, intf.SubnetID)
+		}
+	}
+	available := map[string]int{}
+	if len(subnetIDs) == 0 {
+		return available, nil
+	}
+	subnets, err := c.DescribeSubnets(ctx, subnetIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, subnet := range subnets {
+		available[subnet.SubnetID] = subnet.AvailableIPNum
+	}
+	return available, nil
+}
+
+// SubnetsFromAnnotations returns subnet IDs in value of AnnoKeyVPCSubnet from pod annotations, nil if not set
+func SubnetsFromAnnotations(annotations map[string]string) []string {
+	return splitAnnotation(annotations, AnnoKeyVPCSubnet)
+}
+
+// SecurityGroupsFromAnnotations returns security group IDs in value of AnnoKeyVPCSecurityGroups from pod annotations,
+// nil if not set
+func SecurityGroupsFromAnnotations(annotations map[string]string) []string {
+	return splitAnnotation(annotations, AnnoKeyVPCSecurityGroups)
+}
+
+// splitAnnotation returns comma separated items in value of given annotation key, empty items are ignored
+func splitAnnotation(annotations map[string]string, key string) []string {
+	var items []string
+	for _, item := range strings.Split(annotations[key], ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
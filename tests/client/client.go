@@ -1,11 +1,12 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
-	"time"
+	"strconv"
 
 	"github.com/von1994/vpcapi"
 )
@@ -19,17 +20,24 @@ func main() {
 	if err := json.Unmarshal(data, &conf); err != nil {
 		panic(err)
 	}
+	client, err := vpcapi.NewClient(conf)
+	if err != nil {
+		panic(err)
+	}
+	ctx := context.Background()
 	if len(os.Args) < 2 {
 		fmt.Println("not enough parameters")
-		fmt.Println("getInterfaceByIP <podIP/interfaceIP>\nallocateIP <nodeIP>\nreleaseIP <interfaceID> <podIP>\nmigrateIP <podIP> <oldInterfaceID> <newInterfaceID>")
-		fmt.Println("getInterfaces")
+		fmt.Println("getInterfaceByIP <podIP/interfaceIP>\nallocateIP <nodeIP> [subnetID,...]\nassignIPs <interfaceID> <IP>...\nassignIPCount <interfaceID> <count>\nreleaseIP <interfaceID> <podIP>\nreleaseIPs <interfaceID> <podIP>...\nmigrateIP <podIP> <oldInterfaceID> <newInterfaceID>")
+		fmt.Println("assignIPv6 <interfaceID> <count|IPv6...>\nreleaseIPv6 <interfaceID> <IPv6>...")
+		fmt.Println("getInterfaces\nlocalInterfaces\nbreakerStatus <count>")
+		fmt.Println("createInterface <subnetID> <name>\nattachInterface <interfaceID> <instanceID>\ndetachInterface <interfaceID> <instanceID>\ndeleteInterface <interfaceID>\nsetSecurityGroups <interfaceID> <sgID,...>")
 		return
 	}
 	switch os.Args[1] {
 	case "getInterfaceByIP":
 		{
 			ip := os.Args[2]
-			intf, err := vpcapi.GetInterfaceByIP(conf, ip)
+			intf, err := client.GetInterfaceByIP(ctx, ip)
 			if err != nil {
 				panic(err)
 			}
@@ -39,48 +47,165 @@ func main() {
 	case "allocateIP":
 		{
 			nodeIP := os.Args[2]
-			instanceID, err := vpcapi.GetInstanceID(conf, nodeIP)
+			instance, err := client.GetInstance(ctx, nodeIP)
 			if err != nil {
 				panic(err)
 			}
-			fmt.Printf("instanceID: %s\n", instanceID)
-			interfaces, err := vpcapi.GetInstanceInterfaces(conf, instanceID)
+			fmt.Printf("instanceID: %s, type: %s, zone: %s\n", instance.InstanceID, instance.InstanceType, instance.Zone)
+			interfaces, err := client.GetInstanceInterfaces(ctx, instance.InstanceID)
+			if err != nil {
+				panic(err)
+			}
+			req := &vpcapi.PickRequest{Interfaces: interfaces}
+			if len(os.Args) > 3 {
+				req.RequiredSubnets = vpcapi.SubnetsFromAnnotations(map[string]string{vpcapi.AnnoKeyVPCSubnet: os.Args[3]})
+			}
+			chosenIdx, _, err := client.PickInterfaceForInstance(ctx, instance, req)
+			if vpcapi.NeedNewInterface(err) {
+				fmt.Printf("all interfaces are full, a new interface is needed, since: %v\n", err)
+				return
+			}
 			if err != nil {
 				panic(err)
 			}
-			chosenIdx := vpcapi.PickInterface(conf, interfaces)
 			fmt.Printf("chosen interface: %s\n", interfaces[chosenIdx].NetworkInterfaceID)
-			originIPs := []string{}
-			for _, ip := range interfaces[chosenIdx].PrivateIPAddressSet {
-				originIPs = append(originIPs, ip.PrivateIPAddress)
+			newIP, mac, err := client.AssignIP(ctx, interfaces[chosenIdx].NetworkInterfaceID)
+			if err != nil {
+				panic(err)
+			}
+			fmt.Printf("New IP: %s, interfaceID: %s, MAC: %s\n", newIP, interfaces[chosenIdx].NetworkInterfaceID, mac)
+		}
+	case "assignIPs":
+		{
+			interfaceID := os.Args[2]
+			results, err := client.AssignIPs(ctx, interfaceID, os.Args[3:])
+			for _, result := range results {
+				fmt.Printf("IP: %s, error: %v\n", result.IP, result.Err)
 			}
-			fmt.Printf("origin ips: %v\n", originIPs)
-			if err := vpcapi.AssignIP(conf, interfaces[chosenIdx].NetworkInterfaceID); err != nil {
+			if err != nil {
 				panic(err)
 			}
-			time.Sleep(time.Duration(conf.IPDetect.Delay))
-			found := false
-			for i := 0; i != conf.IPDetect.Retry; i++ {
-				ips, _ := vpcapi.GetInterfaceIPs(conf, interfaces[chosenIdx].NetworkInterfaceID)
-				for _, newIP := range ips {
-					if contains(originIPs, newIP) {
-						continue
-					}
-					fmt.Printf("New IP: %s, instanceID: %s, MAC: %s\n",
-						newIP, interfaces[chosenIdx].NetworkInterfaceID, interfaces[chosenIdx].MacAddress)
-					found = true
-					break
-				}
-				if found {
-					break
-				}
+		}
+	case "assignIPCount":
+		{
+			interfaceID := os.Args[2]
+			count, err := strconv.Atoi(os.Args[3])
+			if err != nil {
+				panic(err)
+			}
+			ips, err := client.AssignIPCount(ctx, interfaceID, count)
+			fmt.Printf("New IPs: %v\n", ips)
+			if err != nil {
+				panic(err)
+			}
+		}
+	case "assignIPv6":
+		{
+			interfaceID := os.Args[2]
+			count, err := strconv.Atoi(os.Args[3])
+			ips := []string{}
+			if err != nil {
+				ips = os.Args[3:]
+			}
+			newIPs, err := client.AssignIPv6s(ctx, interfaceID, count, ips)
+			if err != nil {
+				panic(err)
+			}
+			fmt.Printf("New IPv6s: %v\n", newIPs)
+		}
+	case "releaseIPv6":
+		{
+			if err := client.ReleaseIPv6s(ctx, os.Args[2], os.Args[3:]); err != nil {
+				panic(err)
+			}
+		}
+	case "releaseIPs":
+		{
+			interfaceID := os.Args[2]
+			if err := client.ReleaseIPs(ctx, interfaceID, os.Args[3:]); err != nil {
+				panic(err)
+			}
+		}
+	case "createInterface":
+		{
+			intf, err := client.CreateNetworkInterface(ctx, os.Args[2], os.Args[3])
+			if err != nil {
+				panic(err)
+			}
+			fmt.Printf("InterfaceID:%s\tMAC:%s\n", intf.NetworkInterfaceID, intf.MacAddress)
+		}
+	case "attachInterface":
+		{
+			if err := client.AttachNetworkInterface(ctx, os.Args[2], os.Args[3]); err != nil {
+				panic(err)
+			}
+		}
+	case "detachInterface":
+		{
+			if err := client.DetachNetworkInterface(ctx, os.Args[2], os.Args[3]); err != nil {
+				panic(err)
+			}
+		}
+	case "deleteInterface":
+		{
+			if err := client.DeleteNetworkInterface(ctx, os.Args[2]); err != nil {
+				panic(err)
+			}
+		}
+	case "setSecurityGroups":
+		{
+			groups := vpcapi.SecurityGroupsFromAnnotations(map[string]string{vpcapi.AnnoKeyVPCSecurityGroups: os.Args[3]})
+			if err := client.SetNetworkInterfaceSecurityGroups(ctx, os.Args[2], groups); err != nil {
+				panic(err)
+			}
+			intf, err := client.GetInterface(ctx, os.Args[2])
+			if err != nil {
+				panic(err)
+			}
+			if intf == nil {
+				panic(fmt.Sprintf("interface %s not found", os.Args[2]))
+			}
+			fmt.Printf("InterfaceID:%s\tSecurityGroups:%v\n", intf.NetworkInterfaceID, intf.GroupSet)
+		}
+	case "breakerStatus":
+		{
+			count, err := strconv.Atoi(os.Args[2])
+			if err != nil {
+				panic(err)
+			}
+			// package level function creates a client for each call, breakers are shared by them
+			for i := 0; i < count; i++ {
+				_, err := vpcapi.GetInterfaces(conf)
+				fmt.Printf("request %d, circuit open: %v, error: %v\n", i, vpcapi.IsCircuitOpen(err), err)
+			}
+			for _, status := range client.BreakerStatuses() {
+				fmt.Printf("Endpoint:%s\tAction:%s\tState:%s\tFailures:%d\n", status.Endpoint, status.Action, status.State, status.ConsecutiveFailures)
+			}
+		}
+	case "localInterfaces":
+		{
+			instanceID, err := client.LocalInstanceID(ctx)
+			if err != nil {
+				panic(err)
+			}
+			fmt.Printf("instanceID: %s\n", instanceID)
+			localInterfaces, err := client.LocalInterfaces(ctx)
+			if err != nil {
+				panic(err)
+			}
+			interfaces, err := client.ResolveLocalInterfaces(ctx)
+			if err != nil {
+				panic(err)
+			}
+			for mac, intf := range localInterfaces {
+				fmt.Printf("MAC:%s\tInterfaceID:%s\tIPs:%v\n", mac, interfaces[mac].NetworkInterfaceID, intf.LocalIPv4s)
 			}
 		}
 	case "releaseIP":
 		{
 			interfaceID := os.Args[2]
 			podIP := os.Args[3]
-			if err := vpcapi.ReleaseIP(conf, interfaceID, podIP); err != nil {
+			if err := client.ReleaseIP(ctx, interfaceID, podIP); err != nil {
 				panic(err)
 			}
 		}
@@ -89,13 +214,13 @@ func main() {
 			podIP := os.Args[2]
 			oldInterfaceID := os.Args[3]
 			newInterfaceID := os.Args[4]
-			if err := vpcapi.MigrateIP(conf, podIP, oldInterfaceID, newInterfaceID); err != nil {
+			if err := client.MigrateIP(ctx, podIP, oldInterfaceID, newInterfaceID); err != nil {
 				panic(err)
 			}
 		}
 	case "getInterfaces":
 		{
-			interfaces, err := vpcapi.GetInterfaces(conf)
+			interfaces, err := client.GetInterfaces(ctx)
 			if err != nil {
 				panic(err)
 			}
@@ -115,12 +240,3 @@ func main() {
 		}
 	}
 }
-
-func contains(items []string, one string) bool {
-	for _, item := range items {
-		if item == one {
-			return true
-		}
-	}
-	return false
-}
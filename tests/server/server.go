@@ -2,29 +2,60 @@ package main
 
 import (
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	vpc "github.com/von1994/vpcapi"
+	"github.com/von1994/vpcapi/metadata"
 )
 
 type Node struct {
 	IP   string `json:"ip"`
 	Name string `json:"name"`
+	Type string `json:"type,omitempty"`
+	Zone string `json:"zone,omitempty"`
 }
 type Instances struct {
 	Instances []Node `json:"instances"`
 }
 
 var (
+	metadataNode = flag.String("metadata-node", "n1", "name of instance which fake metadata service serves for")
+	metadataAddr = flag.String("metadata-addr", ":8080", "address fake metadata service listens on")
+	// exhaustedSubnets makes subnets report no available IPs, to test subnet-aware picking
+	exhaustedSubnets = flag.String("exhausted-subnets", "", "comma separated subnet IDs which have no available IPs")
+	// delay and failStatus simulate hung endpoints and failures of proxies or gateways
+	delay      = flag.Duration("delay", 0, "delay before responding each API request")
+	failStatus = flag.Int("fail-status", 0, "http status to respond each API request with, instead of handling it")
+	// slowAction simulates requests timed out after handled, delay is applied after handling requests of it
+	slowAction = flag.String("slow-action", "", "action to delay responding after handled, instead of delaying all")
+
 	vpcID      = "foo"
-	interfaces vpc.DescribeInterfacesResponseData
-	instances  Instances
-	ipPool     = make(map[string]bool)
+	lastTaskID = 0
+	lastEniID  = 0
+	// taskPolls counts polls of each task, tasks keep running for taskRunningPolls polls like real async tasks
+	taskPolls        = map[string]int{}
+	taskRunningPolls = 2
+	interfaces       vpc.DescribeInterfacesResponseData
+	instances        Instances
+	ipPool           = make(map[string]bool)
+	// lastIPv6ID is used to generate IPv6 addresses, assigned ones are in ipv6InUse
+	lastIPv6ID = 0
+	ipv6InUse  = make(map[string]bool)
+	// interfaceLimits is interface quota by instance type, defaultInterfaceLimit is used for types not in it
+	interfaceLimits = map[string]vpc.InterfaceLimit{
+		"S5.LARGE8": {ENIQuantity: 8, ENIPrivateIPAddressQuantity: 10},
+	}
+	defaultInterfaceLimit = vpc.InterfaceLimit{ENIQuantity: 6, ENIPrivateIPAddressQuantity: 3}
 )
 
 func main() {
@@ -42,7 +73,9 @@ func main() {
 		ipPool[fmt.Sprintf("192.168.144.%d", i)] = false
 	}
 
+	flag.Parse()
 	http.HandleFunc("/", dispatch)
+	go serveMetadata()
 
 	log.Println("** Service Started on Port 8443 **")
 
@@ -56,23 +89,82 @@ func main() {
 
 func dispatch(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Content-Type", "application/json")
+	if *slowAction != "" {
+		if r.URL.Query().Get("Action") == *slowAction {
+			recorder := httptest.NewRecorder()
+			handle(recorder, r)
+			time.Sleep(*delay)
+			w.WriteHeader(recorder.Code)
+			w.Write(recorder.Body.Bytes())
+			return
+		}
+	} else {
+		time.Sleep(*delay)
+	}
+	handle(w, r)
+}
+
+func handle(w http.ResponseWriter, r *http.Request) {
 	url := r.URL.String()
+	if *failStatus != 0 {
+		w.WriteHeader(*failStatus)
+		io.WriteString(w, http.StatusText(*failStatus))
+		return
+	}
+	if r.Header.Get("X-TC-Action") == "AssumeRole" {
+		assumeRole(w, r)
+		return
+	}
+	if token := r.URL.Query().Get("Token"); token != "" {
+		fmt.Printf("request with token %s: %s\n", token, r.URL.Query().Get("SecretId"))
+	}
 	if strings.Contains(url, "DescribeNetworkInterfaces") {
 		if strings.Contains(url, "instanceId") {
 			getInstanceInterfaces(w, url)
 		} else if strings.Contains(url, "networkInterfaceId") {
 			getInterfaceByID(w, url)
 		} else {
-			getAllInterfaces(w)
+			getAllInterfaces(w, url)
 		}
 	} else if strings.Contains(url, "DescribeInstances") {
 		getInstance(w, url)
 	} else if strings.Contains(url, "AssignPrivateIpAddresses") {
-		assigneIP(url, "", "")
-		writeResponseCode(w)
+		if ips := getURLValues(url, "privateIpAddress."); len(ips) > 0 {
+			assignSpecificIPs(w, url, ips)
+		} else {
+			count, _ := strconv.Atoi(getURLValue(url, "secondaryPrivateIpAddressCount"))
+			ips := []string{}
+			for i := 0; i < count; i++ {
+				ips = append(ips, assigneIP(url, "", ""))
+			}
+			writeAssignResponse(w, ips)
+		}
 	} else if strings.Contains(url, "UnassignPrivateIpAddresses") {
-		releaseIP(url, "", "")
+		for _, ip := range getURLValues(url, "privateIpAddress.") {
+			releaseIP(url, "", ip)
+			ipPool[ip] = false
+		}
 		writeResponseCode(w)
+	} else if strings.Contains(url, "CreateNetworkInterface") {
+		createInterface(w, url)
+	} else if strings.Contains(url, "AttachNetworkInterface") {
+		attachInterface(w, url, getInstanceName(url))
+	} else if strings.Contains(url, "DetachNetworkInterface") {
+		attachInterface(w, url, "")
+	} else if strings.Contains(url, "DeleteNetworkInterface") {
+		deleteInterface(w, url)
+	} else if strings.Contains(url, "DescribeNetworkInterfaceLimit") {
+		getInterfaceLimit(w, url)
+	} else if strings.Contains(url, "UnassignIpv6Addresses") {
+		releaseIPv6s(w, r.URL.Query())
+	} else if strings.Contains(url, "AssignIpv6Addresses") {
+		assignIPv6s(w, r.URL.Query())
+	} else if strings.Contains(url, "ModifyNetworkInterfaceAttribute") {
+		setSecurityGroups(w, url)
+	} else if strings.Contains(url, "DescribeSubnets") {
+		getSubnets(w, url)
+	} else if strings.Contains(url, "DescribeVpcTaskResult") {
+		writeTaskResult(w, getURLValue(url, "taskId"))
 	} else if strings.Contains(url, "MigratePrivateIpAddress") {
 		migrateIP(url)
 		writeResponseCode(w)
@@ -96,11 +188,69 @@ func writeResponseCode(w http.ResponseWriter) {
 	return
 }
 
-func getAllInterfaces(w http.ResponseWriter) {
+func writeAssignResponse(w http.ResponseWriter, ips []string) {
+	data := vpc.PrivateIPAddressesActionResponse{
+		Data: vpc.PrivateIPAddressesActionResponseData{
+			PrivateIPAddressSet: []vpc.DescribeInterfacesPrivateIPAddresses{},
+		},
+	}
+	for _, ip := range ips {
+		data.Data.PrivateIPAddressSet = append(data.Data.PrivateIPAddressSet, vpc.DescribeInterfacesPrivateIPAddresses{PrivateIPAddress: ip})
+	}
+	dataJSON, _ := json.Marshal(data)
+	io.WriteString(w, string(dataJSON))
+	return
+}
+
+func writeErrorResponse(w http.ResponseWriter, code int, codeDesc, message string) {
+	data := map[string]interface{}{
+		"code":     code,
+		"codeDesc": codeDesc,
+		"message":  message,
+	}
+	dataJSON, _ := json.Marshal(data)
+	io.WriteString(w, string(dataJSON))
+	return
+}
+
+func paginate(url, offsetKey, limitKey string, total int) (int, int) {
+	offset, _ := strconv.Atoi(getURLValue(url, offsetKey+"="))
+	limit, err := strconv.Atoi(getURLValue(url, limitKey+"="))
+	if err != nil || limit <= 0 {
+		limit = total
+	}
+	if offset > total {
+		offset = total
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+	return offset, end
+}
+
+func getAllInterfaces(w http.ResponseWriter, url string) {
+	matched := interfaces.Data
+	if getURLValue(url, "Filters.0.Name") == "address-ip" {
+		ip := getURLValue(url, "Filters.0.Values.0")
+		matched = []vpc.DescribeInterfacesNetworkInterface{}
+		for _, intf := range interfaces.Data {
+			for _, intfIP := range intf.PrivateIPAddressSet {
+				if intfIP.PrivateIPAddress == ip {
+					matched = append(matched, intf)
+					break
+				}
+			}
+		}
+	}
+	start, end := paginate(url, "offset", "limit", len(matched))
 	data := &vpc.DescribeInterfacesResponse{
 		Code:     0,
 		CodeDesc: "",
-		Data:     interfaces,
+		Data: vpc.DescribeInterfacesResponseData{
+			TotalNum: len(matched),
+			Data:     matched[start:end],
+		},
 	}
 	dataJSON, _ := json.Marshal(data)
 	io.WriteString(w, string(dataJSON))
@@ -108,27 +258,104 @@ func getAllInterfaces(w http.ResponseWriter) {
 }
 
 func getInstance(w http.ResponseWriter, url string) {
-	instanceID := ""
 	ip := getURLValue(url, "Filters.0.Values.0")
+	matched := []vpc.CVMDescribeInstancesInstance{}
 	for _, instance := range instances.Instances {
-		if instance.IP == ip {
-			instanceID = instance.Name
-			break
+		if ip == "" || instance.IP == ip {
+			matched = append(matched, vpc.CVMDescribeInstancesInstance{
+				InstanceID:          instance.Name,
+				InstanceType:        instance.Type,
+				InstanceState:       "RUNNING",
+				Placement:           vpc.CVMDescribeInstancesPlacement{Zone: instance.Zone},
+				VirtualPrivateCloud: vpc.CVMDescribeInstancesVirtualPrivateCloud{VpcID: vpcID},
+				PrivateIPAddresses:  []string{instance.IP},
+			})
 		}
 	}
-	fmt.Printf("getInstance: ip %s instanceID %s", ip, instanceID)
+	fmt.Printf("getInstance: ip %s instances %v\n", ip, matched)
+	start, end := paginate(url, "Offset", "Limit", len(matched))
 	data := &vpc.CVMDescribeInstancesResponse{
 		Body: vpc.CVMDescribeInstancesResponseBody{
-			TotalCount:  1,
-			InstanceSet: []vpc.CVMDescribeInstancesInstance{},
+			TotalCount:  len(matched),
+			InstanceSet: matched[start:end],
+		},
+	}
+	dataJSON, _ := json.Marshal(data)
+	io.WriteString(w, string(dataJSON))
+	return
+}
+
+func getInterfaceLimit(w http.ResponseWriter, url string) {
+	instName := getInstanceName(url)
+	limit := defaultInterfaceLimit
+	for _, instance := range instances.Instances {
+		if instance.Name == instName {
+			if l, ok := interfaceLimits[instance.Type]; ok {
+				limit = l
+			}
+			break
+		}
+	}
+	data := &vpc.DescribeNetworkInterfaceLimitResponse{Data: limit}
+	dataJSON, _ := json.Marshal(data)
+	io.WriteString(w, string(dataJSON))
+	return
+}
+
+// getSubnets reports subnets of interfaces, all of them share ipPool
+func getSubnets(w http.ResponseWriter, url string) {
+	subnetIDs := getURLValues(url, "subnetIds.")
+	free := 0
+	for _, used := range ipPool {
+		if !used {
+			free++
+		}
+	}
+	exhausted := strings.Split(*exhaustedSubnets, ",")
+	matched := []vpc.DescribeSubnetsSubnet{}
+	seen := map[string]bool{}
+	for _, intf := range interfaces.Data {
+		if seen[intf.SubnetID] {
+			continue
+		}
+		seen[intf.SubnetID] = true
+		if len(subnetIDs) > 0 && !contains(subnetIDs, intf.SubnetID) {
+			continue
+		}
+		subnet := vpc.DescribeSubnetsSubnet{
+			SubnetID:       intf.SubnetID,
+			SubnetName:     intf.SubnetID,
+			VpcID:          vpcID,
+			CidrBlock:      "192.168.144.0/24",
+			TotalIPNum:     len(ipPool),
+			AvailableIPNum: free,
+		}
+		if contains(exhausted, intf.SubnetID) {
+			subnet.AvailableIPNum = 0
+		}
+		matched = append(matched, subnet)
+	}
+	start, end := paginate(url, "offset", "limit", len(matched))
+	data := &vpc.DescribeSubnetsResponse{
+		Data: vpc.DescribeSubnetsResponseData{
+			TotalNum: len(matched),
+			Data:     matched[start:end],
 		},
 	}
-	data.Body.InstanceSet = append(data.Body.InstanceSet, vpc.CVMDescribeInstancesInstance{InstanceID: instanceID})
 	dataJSON, _ := json.Marshal(data)
 	io.WriteString(w, string(dataJSON))
 	return
 }
 
+func contains(items []string, one string) bool {
+	for _, item := range items {
+		if item == one {
+			return true
+		}
+	}
+	return false
+}
+
 func getURLValue(url, key string) string {
 	ifName := ""
 	for _, sub := range strings.Split(strings.Split(url, "?")[1], "&") {
@@ -140,6 +367,16 @@ func getURLValue(url, key string) string {
 	return ifName
 }
 
+func getURLValues(url, prefix string) []string {
+	values := []string{}
+	for _, sub := range strings.Split(strings.Split(url, "?")[1], "&") {
+		if strings.HasPrefix(sub, prefix) {
+			values = append(values, strings.Split(sub, "=")[1])
+		}
+	}
+	return values
+}
+
 func getIfName(url string) string {
 	return getURLValue(url, "networkInterfaceId")
 }
@@ -152,7 +389,7 @@ func getIP(url string) string {
 	return getURLValue(url, "privateIpAddress.0")
 }
 
-func assigneIP(url, ifName, ip string) {
+func assigneIP(url, ifName, ip string) string {
 	if ifName == "" {
 		ifName = getIfName(url)
 	}
@@ -172,6 +409,106 @@ func assigneIP(url, ifName, ip string) {
 			break
 		}
 	}
+	return ip
+}
+
+func findInterface(ifName string) *vpc.DescribeInterfacesNetworkInterface {
+	for idx := range interfaces.Data {
+		if interfaces.Data[idx].NetworkInterfaceID == ifName {
+			return &interfaces.Data[idx]
+		}
+	}
+	return nil
+}
+
+func getIPv6Params(query neturl.Values) []string {
+	ips := []string{}
+	for i := 0; query.Get(fmt.Sprintf("ipv6Addresses.%d.address", i)) != ""; i++ {
+		ips = append(ips, query.Get(fmt.Sprintf("ipv6Addresses.%d.address", i)))
+	}
+	return ips
+}
+
+func writeIPv6Response(w http.ResponseWriter, ips []string) {
+	data := vpc.Ipv6AddressesActionResponse{}
+	for _, ip := range ips {
+		data.Data.Ipv6AddressSet = append(data.Data.Ipv6AddressSet, vpc.DescribeInterfacesIpv6Address{Address: ip})
+	}
+	dataJSON, _ := json.Marshal(data)
+	io.WriteString(w, string(dataJSON))
+}
+
+func assignIPv6s(w http.ResponseWriter, query neturl.Values) {
+	intf := findInterface(query.Get("networkInterfaceId"))
+	if intf == nil {
+		writeErrorResponse(w, 4000, "InvalidNetworkInterfaceId.NotFound", fmt.Sprintf("interface %s not found", query.Get("networkInterfaceId")))
+		return
+	}
+	ips := getIPv6Params(query)
+	for _, ip := range ips {
+		if ipv6InUse[ip] {
+			writeErrorResponse(w, 4000, "InvalidIpv6Address.InUse", fmt.Sprintf("ipv6 %s is in use", ip))
+			return
+		}
+	}
+	if len(ips) == 0 {
+		count, _ := strconv.Atoi(query.Get("ipv6AddressCount"))
+		for i := 0; i < count; i++ {
+			lastIPv6ID++
+			ips = append(ips, fmt.Sprintf("2402:4e00:1013:e500::%x", lastIPv6ID))
+		}
+	}
+	for _, ip := range ips {
+		ipv6InUse[ip] = true
+		intf.Ipv6AddressSet = append(intf.Ipv6AddressSet, vpc.DescribeInterfacesIpv6Address{Address: ip})
+	}
+	fmt.Printf("After assign IPv6: %v\n", intf.Ipv6AddressSet)
+	writeIPv6Response(w, ips)
+}
+
+func releaseIPv6s(w http.ResponseWriter, query neturl.Values) {
+	intf := findInterface(query.Get("networkInterfaceId"))
+	if intf == nil {
+		writeErrorResponse(w, 4000, "InvalidNetworkInterfaceId.NotFound", fmt.Sprintf("interface %s not found", query.Get("networkInterfaceId")))
+		return
+	}
+	ips := getIPv6Params(query)
+	left := []vpc.DescribeInterfacesIpv6Address{}
+	for _, ip := range intf.Ipv6AddressSet {
+		if contains(ips, ip.Address) {
+			delete(ipv6InUse, ip.Address)
+		} else {
+			left = append(left, ip)
+		}
+	}
+	intf.Ipv6AddressSet = left
+	fmt.Printf("After release IPv6: %v\n", intf.Ipv6AddressSet)
+	writeIPv6Response(w, nil)
+}
+
+func setSecurityGroups(w http.ResponseWriter, url string) {
+	intf := findInterface(getIfName(url))
+	if intf == nil {
+		writeErrorResponse(w, 4000, "InvalidNetworkInterfaceId.NotFound", fmt.Sprintf("interface %s not found", getIfName(url)))
+		return
+	}
+	intf.GroupSet = getURLValues(url, "securityGroupIds.")
+	fmt.Printf("After set security groups: %v\n", intf.GroupSet)
+	writeInterfaceActionResponse(w, intf.NetworkInterfaceID, true)
+}
+
+func assignSpecificIPs(w http.ResponseWriter, url string, ips []string) {
+	for _, ip := range ips {
+		if used, ok := ipPool[ip]; ok && used {
+			writeErrorResponse(w, 4000, "InvalidPrivateIpAddress.InUse", fmt.Sprintf("ip %s is in use", ip))
+			return
+		}
+	}
+	for _, ip := range ips {
+		ipPool[ip] = true
+		assigneIP(url, "", ip)
+	}
+	writeResponseCode(w)
 }
 
 func releaseIP(url, ifName, ip string) {
@@ -230,20 +567,179 @@ func getInterfaceByID(w http.ResponseWriter, url string) {
 
 func getInstanceInterfaces(w http.ResponseWriter, url string) {
 	instName := getInstanceName(url)
+	matched := []vpc.DescribeInterfacesNetworkInterface{}
+	for _, intf := range interfaces.Data {
+		if intf.Instance.InstanceID == instName {
+			matched = append(matched, intf)
+		}
+	}
+	start, end := paginate(url, "offset", "limit", len(matched))
 	data := &vpc.DescribeInterfacesResponse{
 		Code:     0,
 		CodeDesc: "",
 		Data: vpc.DescribeInterfacesResponseData{
-			Data: []vpc.DescribeInterfacesNetworkInterface{},
+			TotalNum: len(matched),
+			Data:     matched[start:end],
 		},
 	}
-	for _, intf := range interfaces.Data {
-		if strings.HasPrefix(intf.NetworkInterfaceID, instName) {
-			data.Data.Data = append(data.Data.Data, intf)
+	fmt.Printf("getInstanceInterfaces will response interfaces: %v\n", data.Data.Data)
+	dataJSON, _ := json.Marshal(data)
+	io.WriteString(w, string(dataJSON))
+	return
+}
+
+func allocatePoolIP() string {
+	for ip, used := range ipPool {
+		if !used {
+			ipPool[ip] = true
+			return ip
 		}
 	}
-	fmt.Printf("getInstanceInterfaces will response interfaces: %v\n", data.Data.Data)
+	return ""
+}
+
+func writeInterfaceActionResponse(w http.ResponseWriter, interfaceID string, async bool) {
+	data := vpc.NetworkInterfaceActionResponse{
+		Data: vpc.NetworkInterfaceActionResponseData{
+			NetworkInterfaceID: interfaceID,
+		},
+	}
+	if async {
+		lastTaskID++
+		data.Data.TaskID = lastTaskID
+	}
 	dataJSON, _ := json.Marshal(data)
 	io.WriteString(w, string(dataJSON))
 	return
 }
+
+func writeTaskResult(w http.ResponseWriter, taskID string) {
+	data := vpc.DescribeVpcTaskResultResponse{
+		Data: vpc.DescribeVpcTaskResultData{
+			Status: vpc.TaskStatusSuccess,
+		},
+	}
+	taskPolls[taskID]++
+	if taskPolls[taskID] <= taskRunningPolls {
+		data.Data.Status = vpc.TaskStatusRunning
+	}
+	dataJSON, _ := json.Marshal(data)
+	io.WriteString(w, string(dataJSON))
+	return
+}
+
+func createInterface(w http.ResponseWriter, url string) {
+	lastEniID++
+	intf := vpc.DescribeInterfacesNetworkInterface{
+		MacAddress:           fmt.Sprintf("52:54:00:00:%02x:%02x", lastEniID/256, lastEniID%256),
+		NetworkInterfaceID:   fmt.Sprintf("eni-%08d", lastEniID),
+		NetworkInterfaceName: getURLValue(url, "networkInterfaceName"),
+		PrivateIPAddressSet: []vpc.DescribeInterfacesPrivateIPAddresses{
+			{Primary: true, PrivateIPAddress: allocatePoolIP()},
+		},
+		SubnetID: getURLValue(url, "subnetId"),
+		VpcID:    vpcID,
+		VpcName:  vpcID,
+	}
+	interfaces.Data = append(interfaces.Data, intf)
+	fmt.Printf("After create: %v\n", intf)
+	writeInterfaceActionResponse(w, intf.NetworkInterfaceID, false)
+}
+
+func attachInterface(w http.ResponseWriter, url, instName string) {
+	ifName := getIfName(url)
+	for idx := range interfaces.Data {
+		if interfaces.Data[idx].NetworkInterfaceID == ifName {
+			interfaces.Data[idx].Instance.InstanceID = instName
+			writeInterfaceActionResponse(w, ifName, true)
+			return
+		}
+	}
+	writeErrorResponse(w, 4000, "InvalidNetworkInterfaceId.NotFound", fmt.Sprintf("interface %s not found", ifName))
+}
+
+func deleteInterface(w http.ResponseWriter, url string) {
+	ifName := getIfName(url)
+	for idx := range interfaces.Data {
+		if interfaces.Data[idx].NetworkInterfaceID != ifName {
+			continue
+		}
+		if interfaces.Data[idx].Instance.InstanceID != "" {
+			writeErrorResponse(w, 4000, "UnsupportedOperation.InterfaceAttached", fmt.Sprintf("interface %s is attached", ifName))
+			return
+		}
+		for _, ip := range interfaces.Data[idx].PrivateIPAddressSet {
+			ipPool[ip.PrivateIPAddress] = false
+		}
+		interfaces.Data = append(interfaces.Data[:idx], interfaces.Data[idx+1:]...)
+		writeInterfaceActionResponse(w, ifName, true)
+		return
+	}
+	writeErrorResponse(w, 4000, "InvalidNetworkInterfaceId.NotFound", fmt.Sprintf("interface %s not found", ifName))
+}
+
+// assumeRole returns temporary credential expiring in 1 hour for API 3.0 request AssumeRole
+func assumeRole(w http.ResponseWriter, r *http.Request) {
+	fmt.Printf("AssumeRole: %s\n", r.Header.Get("Authorization"))
+	data := map[string]interface{}{
+		"Response": map[string]interface{}{
+			"Credentials": map[string]string{
+				"Token":        "sts-token",
+				"TmpSecretId":  "sts-id",
+				"TmpSecretKey": "sts-key",
+			},
+			"ExpiredTime": time.Now().Add(time.Hour).Unix(),
+			"RequestId":   "foo",
+		},
+	}
+	dataJSON, _ := json.Marshal(data)
+	io.WriteString(w, string(dataJSON))
+}
+
+// serveMetadata serves fake metadata service with plain http, as metadata service inside of CVM does
+func serveMetadata() {
+	fake := metadata.NewFake(metadata.FakeData{})
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		fake.Set(getMetadata(*metadataNode))
+		fake.ServeHTTP(w, r)
+	}
+	log.Printf("** Metadata Service Started on %s for %s **", *metadataAddr, *metadataNode)
+	if err := http.ListenAndServe(*metadataAddr, http.HandlerFunc(handler)); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func getMetadata(instName string) metadata.FakeData {
+	data := metadata.FakeData{
+		InstanceID: instName,
+		Region:     "foo",
+		CAMRole:    "vpc-cni",
+		CAMCredentials: &metadata.RoleCredentials{
+			TmpSecretID:  "cam-id",
+			TmpSecretKey: "cam-key",
+			Token:        "cam-token",
+			ExpiredTime:  time.Now().Add(time.Hour).Unix(),
+			Code:         "Success",
+		},
+	}
+	for _, instance := range instances.Instances {
+		if instance.Name == instName {
+			data.Zone = instance.Zone
+			data.LocalIPv4 = instance.IP
+		}
+	}
+	for _, intf := range interfaces.Data {
+		if intf.Instance.InstanceID != instName {
+			continue
+		}
+		mdIntf := metadata.Interface{MAC: intf.MacAddress, InterfaceID: intf.NetworkInterfaceID}
+		for _, ip := range intf.PrivateIPAddressSet {
+			if ip.Primary {
+				mdIntf.PrimaryLocalIPv4 = ip.PrivateIPAddress
+			}
+			mdIntf.LocalIPv4s = append(mdIntf.LocalIPv4s, ip.PrivateIPAddress)
+		}
+		data.Interfaces = append(data.Interfaces, mdIntf)
+	}
+	return data
+}
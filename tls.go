@@ -0,0 +1,54 @@
+package vpcapi
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+)
+
+// TLSConfig defines how to verify API endpoints, and the client certificate to present if required
+type TLSConfig struct {
+	// CAFile is path of PEM encoded CA bundle, which is trusted besides of system CAs
+	CAFile string `json:"caFile,omitempty"`
+	// CertFile and KeyFile are paths of PEM encoded client certificate and its key
+	CertFile string `json:"certFile,omitempty"`
+	KeyFile  string `json:"keyFile,omitempty"`
+	// ServerName overrides host name to verify certificate of endpoints
+	ServerName string `json:"serverName,omitempty"`
+	// InsecureSkipVerify disables certificate verification, only for testing, never set it in production
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+}
+
+// NewTLSConfig creates *tls.Config based on given TLS config, certificates of endpoints are verified with system CAs
+// if conf is nil
+func NewTLSConfig(conf *TLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{}
+	if conf == nil {
+		return tlsConfig, nil
+	}
+	if conf.CAFile != "" {
+		pem, err := ioutil.ReadFile(conf.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("VPC.API: failed to read CA file %s, since: %v", conf.CAFile, err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("VPC.API: no certificate found in CA file %s", conf.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if conf.CertFile != "" || conf.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(conf.CertFile, conf.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("VPC.API: failed to load client certificate %s, since: %v", conf.CertFile, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	tlsConfig.ServerName = conf.ServerName
+	tlsConfig.InsecureSkipVerify = conf.InsecureSkipVerify
+	return tlsConfig, nil
+}
@@ -0,0 +1,100 @@
+package vpcapi
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+const (
+	defaultDialTimeout = 30 * time.Second
+	defaultKeepAlive   = 30 * time.Second
+)
+
+// TransportConfig defines how to connect to API endpoints
+type TransportConfig struct {
+	// Proxy is URL of proxy for API requests, like "http://proxy:3128", if not set, proxy in environment variables
+	// HTTPS_PROXY, HTTP_PROXY and NO_PROXY is used
+	Proxy string `json:"proxy,omitempty"`
+	// NoProxy is comma separated hosts which are requested directly without proxy, with the same semantics of NO_PROXY,
+	// like ".internal.tencentyun.com,10.0.0.0/8", it overrides NO_PROXY even if Proxy is not set. Requests to localhost
+	// and loopback IPs are never proxied
+	NoProxy string `json:"noProxy,omitempty"`
+	// DialTimeout is timeout in ms to establish a connection, default to 30000
+	DialTimeout int `json:"dialTimeout,omitempty"`
+	// KeepAlive is interval in ms of TCP keepalive probes, default to 30000, negative value disables keepalive
+	KeepAlive int `json:"keepAlive,omitempty"`
+	// SourceAddress is local IP which connections are made from, to make requests go through a specific interface
+	SourceAddress string `json:"sourceAddress,omitempty"`
+}
+
+// proxyFunc returns proxy function for http.Transport based on given config
+func (conf *TransportConfig) proxyFunc() (func(*http.Request) (*url.URL, error), error) {
+	if conf.Proxy == "" && conf.NoProxy == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+	proxyConf := &httpproxy.Config{
+		HTTPProxy:  conf.Proxy,
+		HTTPSProxy: conf.Proxy,
+		NoProxy:    conf.NoProxy,
+	}
+	if conf.Proxy == "" {
+		// only NoProxy is set, proxy in environment variables is used with NO_PROXY overridden
+		proxyConf = httpproxy.FromEnvironment()
+		proxyConf.NoProxy = conf.NoProxy
+	} else if _, err := url.Parse(conf.Proxy); err != nil {
+		return nil, fmt.Errorf("VPC.API: invalid proxy %s, since: %v", conf.Proxy, err)
+	}
+	proxy := proxyConf.ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return proxy(req.URL)
+	}, nil
+}
+
+// dialer returns dialer for http.Transport based on given config
+func (conf *TransportConfig) dialer() (*net.Dialer, error) {
+	dialer := &net.Dialer{Timeout: defaultDialTimeout, KeepAlive: defaultKeepAlive}
+	if conf.DialTimeout > 0 {
+		dialer.Timeout = time.Duration(conf.DialTimeout) * time.Millisecond
+	}
+	if conf.KeepAlive != 0 {
+		dialer.KeepAlive = time.Duration(conf.KeepAlive) * time.Millisecond
+	}
+	if conf.SourceAddress != "" {
+		ip := net.ParseIP(conf.SourceAddress)
+		if ip == nil {
+			return nil, fmt.Errorf("VPC.API: invalid source address %s", conf.SourceAddress)
+		}
+		dialer.LocalAddr = &net.TCPAddr{IP: ip}
+	}
+	return dialer, nil
+}
+
+// newTransport creates the transport shared by requests of Client, based on TLS and transport config in given vpc
+// config
+func newTransport(conf VPC) (*http.Transport, error) {
+	tlsConfig, err := NewTLSConfig(conf.TLS)
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	if conf.Transport == nil {
+		return transport, nil
+	}
+	proxy, err := conf.Transport.proxyFunc()
+	if err != nil {
+		return nil, err
+	}
+	dialer, err := conf.Transport.dialer()
+	if err != nil {
+		return nil, err
+	}
+	transport.Proxy = proxy
+	transport.DialContext = dialer.DialContext
+	return transport, nil
+}
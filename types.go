@@ -1,5 +1,7 @@
 package vpcapi
 
+import "encoding/json"
+
 const (
 	// AnnoKeyVPCIPAM is used to enable IPAM for VPC.  To enable it set value to true-like.
 	// TODO: it's necessary to add support for VPC in IPClaim CRD, since user may want to known IPs before they
@@ -26,6 +28,13 @@ const (
 	// instanceID in pod annotations not match instanceID of node, which means it's "pod migration". So for "pod migration",
 	// CNI need to call overlay API to do ip migration.
 	AnnoKeyVPCInstanceID = "alcor.io/vpc-cni.instanceID"
+	// AnnoKeyVPCSubnet limits interfaces pod IP can be allocated from to those in the given subnets, multiple subnet IDs
+	// are separated by comma, like "subnet-a,subnet-b". It can be set in annotations for a new created pod.
+	AnnoKeyVPCSubnet = "alcor.io/vpc-cni.subnet"
+	// AnnoKeyVPCSecurityGroups requests security groups bound to network interface of pod, multiple security group IDs
+	// are separated by comma, like "sg-a,sg-b". Since security groups are bound to the whole interface, it only works
+	// with VPCPolicyExclusive, where each pod owns an interface.
+	AnnoKeyVPCSecurityGroups = "alcor.io/vpc-cni.securityGroups"
 
 	// VPCPolicyExclusive policy will make sure each pod have a separate CVM network interface to use
 	VPCPolicyExclusive = "Exclusive"
@@ -35,9 +44,56 @@ const (
 	VPCPolicySharePrimary = "SharePrimary"
 )
 
+// CVMDescribeInstancesPlacement is "Placement" of instance in response body of cvm request DescribeInstances
+type CVMDescribeInstancesPlacement struct {
+	Zone string `json:"Zone"`
+}
+
+// CVMDescribeInstancesVirtualPrivateCloud is "VirtualPrivateCloud" of instance in response body of cvm request
+// DescribeInstances
+type CVMDescribeInstancesVirtualPrivateCloud struct {
+	VpcID    string `json:"VpcId"`
+	SubnetID string `json:"SubnetId"`
+}
+
 // CVMDescribeInstancesInstance is member of "InstanceSet" in response body of cmv reqeust DescribeInstances
 type CVMDescribeInstancesInstance struct {
-	InstanceID string `json:"InstanceId"`
+	InstanceID          string                                  `json:"InstanceId"`
+	InstanceType        string                                  `json:"InstanceType,omitempty"`
+	InstanceState       string                                  `json:"InstanceState,omitempty"`
+	Placement           CVMDescribeInstancesPlacement           `json:"Placement"`
+	VirtualPrivateCloud CVMDescribeInstancesVirtualPrivateCloud `json:"VirtualPrivateCloud"`
+	PrivateIPAddresses  []string                                `json:"PrivateIpAddresses,omitempty"`
+}
+
+// DescribeNetworkInterfaceLimitResponse is response of vpc request DescribeNetworkInterfaceLimit
+type DescribeNetworkInterfaceLimitResponse struct {
+	Code     int            `json:"code"`
+	CodeDesc string         `json:"codeDesc"`
+	Message  string         `json:"message"`
+	Data     InterfaceLimit `json:"data"`
+}
+
+// Instance is CVM instance info used by CNI
+type Instance struct {
+	InstanceID         string
+	InstanceType       string
+	InstanceState      string
+	Zone               string
+	VpcID              string
+	SubnetID           string
+	PrivateIPAddresses []string
+	// ENILimit is the max number of network interfaces can be attached to the instance, 0 if unknown
+	ENILimit int
+	// IPPerENILimit is the max number of private IPs on each network interface, 0 if unknown
+	IPPerENILimit int
+}
+
+// InterfaceLimit defines network interface quota for an instance type, ENIPrivateIPAddressQuantity includes the
+// primary IP of interface
+type InterfaceLimit struct {
+	ENIQuantity                 int `json:"eniQuantity"`
+	ENIPrivateIPAddressQuantity int `json:"eniPrivateIpAddressQuantity"`
 }
 
 // CVMDescribeInstancesResponseBody is "Response" in response body of cvm request DescribeInstances
@@ -57,6 +113,15 @@ type DescribeInterfacesPrivateIPAddresses struct {
 	PrivateIPAddress string `json:"privateIpAddress"`
 }
 
+// DescribeInterfacesIpv6Address is member of data.data.ipv6AddressSet in response of vpc request
+// DescribeNetworkInterfaces, and of data.ipv6AddressSet in response of vpc request AssignIpv6Addresses
+type DescribeInterfacesIpv6Address struct {
+	Address     string `json:"address"`
+	Primary     bool   `json:"primary,omitempty"`
+	AddressID   string `json:"addressId,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
 // DescribeInterfacesInstance is data.data.instanceSet in response of vpc request DescribeNetworkInterfaces
 type DescribeInterfacesInstance struct {
 	InstanceID string `json:"instanceId"`
@@ -64,19 +129,47 @@ type DescribeInterfacesInstance struct {
 
 // DescribeInterfacesNetworkInterface is member of data.data in response of vpc request DescribeNetworkInterfaces
 type DescribeInterfacesNetworkInterface struct {
-	Instance            DescribeInterfacesInstance             `json:"instanceSet"`
-	MacAddress          string                                 `json:"macAddress"`
-	NetworkInterfaceID  string                                 `json:"networkInterfaceId"`
-	Primary             bool                                   `json:"primary"`
-	PrivateIPAddressSet []DescribeInterfacesPrivateIPAddresses `json:"privateIpAddressesSet"`
-	SubnetID            string                                 `json:"subnetId"`
-	VpcID               string                                 `json:"vpcId"`
-	VpcName             string                                 `json:"vpcName"`
+	Instance             DescribeInterfacesInstance             `json:"instanceSet"`
+	MacAddress           string                                 `json:"macAddress"`
+	NetworkInterfaceID   string                                 `json:"networkInterfaceId"`
+	NetworkInterfaceName string                                 `json:"networkInterfaceName,omitempty"`
+	Primary              bool                                   `json:"primary"`
+	PrivateIPAddressSet  []DescribeInterfacesPrivateIPAddresses `json:"privateIpAddressesSet"`
+	Ipv6AddressSet       []DescribeInterfacesIpv6Address        `json:"ipv6AddressSet,omitempty"`
+	SubnetID             string                                 `json:"subnetId"`
+	GroupSet             []string                               `json:"groupSet,omitempty"`
+	VpcID                string                                 `json:"vpcId"`
+	VpcName              string                                 `json:"vpcName"`
 }
 
 // DescribeInterfacesResponseData is data.data of response of vpc request DescribeNetworkInterfaces
 type DescribeInterfacesResponseData struct {
-	Data []DescribeInterfacesNetworkInterface `json:"data"`
+	TotalNum int                                  `json:"totalNum"`
+	Data     []DescribeInterfacesNetworkInterface `json:"data"`
+}
+
+// DescribeSubnetsSubnet is member of data.data in response of vpc request DescribeSubnets
+type DescribeSubnetsSubnet struct {
+	SubnetID       string `json:"subnetId"`
+	SubnetName     string `json:"subnetName"`
+	VpcID          string `json:"vpcId"`
+	CidrBlock      string `json:"cidrBlock"`
+	Zone           string `json:"zone"`
+	TotalIPNum     int    `json:"totalIpNum"`
+	AvailableIPNum int    `json:"availableIpNum"`
+}
+
+// DescribeSubnetsResponseData is data of response of vpc request DescribeSubnets
+type DescribeSubnetsResponseData struct {
+	TotalNum int                     `json:"totalNum"`
+	Data     []DescribeSubnetsSubnet `json:"data"`
+}
+
+// DescribeSubnetsResponse is response of vpc request DescribeSubnets
+type DescribeSubnetsResponse struct {
+	Code     int                         `json:"code"`
+	CodeDesc string                      `json:"codeDesc"`
+	Data     DescribeSubnetsResponseData `json:"data"`
 }
 
 // DescribeInterfacesResponse is response of vpc request DescribeNetworkInterfaces
@@ -90,6 +183,8 @@ type DescribeInterfacesResponse struct {
 type PrivateIPAddressesActionResponseData struct {
 	Code     int    `json:"code"`
 	CodeDesc string `json:"codeDesc"`
+	// PrivateIPAddressSet contains assigned IPs in response of AssignPrivateIpAddresses, it may be empty
+	PrivateIPAddressSet []DescribeInterfacesPrivateIPAddresses `json:"privateIpAddressSet,omitempty"`
 }
 
 // PrivateIPAddressesActionResponse is response of vpc request AssignPrivateIpAddresses
@@ -99,6 +194,66 @@ type PrivateIPAddressesActionResponse struct {
 	Code    int                                  `json:"code"`
 }
 
+// Ipv6AddressesActionResponseData is data of response of vpc request AssignIpv6Addresses and UnassignIpv6Addresses
+type Ipv6AddressesActionResponseData struct {
+	// Ipv6AddressSet contains assigned addresses in response of AssignIpv6Addresses, it may be empty
+	Ipv6AddressSet []DescribeInterfacesIpv6Address `json:"ipv6AddressSet,omitempty"`
+}
+
+// Ipv6AddressesActionResponse is response of vpc request AssignIpv6Addresses and UnassignIpv6Addresses
+type Ipv6AddressesActionResponse struct {
+	Code     int                             `json:"code"`
+	CodeDesc string                          `json:"codeDesc"`
+	Message  string                          `json:"message"`
+	Data     Ipv6AddressesActionResponseData `json:"data"`
+}
+
+// NetworkInterfaceActionResponseData is data of response of vpc request CreateNetworkInterface,
+// AttachNetworkInterface, DetachNetworkInterface and DeleteNetworkInterface
+type NetworkInterfaceActionResponseData struct {
+	NetworkInterfaceID string `json:"networkInterfaceId,omitempty"`
+	MacAddress         string `json:"macAddress,omitempty"`
+	TaskID             int    `json:"taskId,omitempty"`
+}
+
+// NetworkInterfaceActionResponse is response of vpc request CreateNetworkInterface, AttachNetworkInterface,
+// DetachNetworkInterface and DeleteNetworkInterface
+type NetworkInterfaceActionResponse struct {
+	Code     int                                `json:"code"`
+	CodeDesc string                             `json:"codeDesc"`
+	Message  string                             `json:"message"`
+	TaskID   int                                `json:"taskId,omitempty"`
+	Data     NetworkInterfaceActionResponseData `json:"data"`
+}
+
+// GetTaskID returns ID of async task for the action, 0 if action is not async
+func (r *NetworkInterfaceActionResponse) GetTaskID() int {
+	if r.TaskID != 0 {
+		return r.TaskID
+	}
+	return r.Data.TaskID
+}
+
+// DescribeVpcTaskResultData is data of response of vpc request DescribeVpcTaskResult
+type DescribeVpcTaskResultData struct {
+	Status int             `json:"status"`
+	Output json.RawMessage `json:"output,omitempty"`
+}
+
+// DescribeVpcTaskResultResponse is response of vpc request DescribeVpcTaskResult
+type DescribeVpcTaskResultResponse struct {
+	Code     int                       `json:"code"`
+	CodeDesc string                    `json:"codeDesc"`
+	Message  string                    `json:"message"`
+	Data     DescribeVpcTaskResultData `json:"data"`
+}
+
+// AssignIPResult is result of assigning a specified IP to interface
+type AssignIPResult struct {
+	IP  string
+	Err error
+}
+
 // IPAssign defines parameters for ip assignment API for vpc
 type IPAssign struct {
 	Retry    int `json:"retry,omitempty"`
@@ -119,6 +274,15 @@ type IPMigrate struct {
 	PostCheckInterval int `json:"postCheckInterval,omitempty"`
 }
 
+// InterfaceOp defines parameters for network interface create, attach, detach and delete API for vpc, task retry and
+// interval are used to poll async task of the operation, default to 60 * 1000ms
+type InterfaceOp struct {
+	Retry        int `json:"retry,omitempty"`
+	Interval     int `json:"interval,omitempty"`
+	TaskRetry    int `json:"taskRetry,omitempty"`
+	TaskInterval int `json:"taskInterval,omitempty"`
+}
+
 // IPDetect defines struct for detect ip for vpc
 type IPDetect struct {
 	Delay    int `json:"delay,omitempty"`
@@ -147,4 +311,35 @@ type VPC struct {
 	IPRelease      IPRelease `json:"ipRelease,omitempty"`
 	IPDetect       IPDetect  `json:"ipDetect,omitempty"`
 	IPMigrate      IPMigrate `json:"ipMigrate,omitempty"`
+	// SignatureMethod is HmacSHA1 by default. With TC3-HMAC-SHA256, cvm and sts requests of API 3.0 are signed by it,
+	// while vpc requests are v2 API and still signed by HmacSHA1
+	SignatureMethod string `json:"signatureMethod,omitempty"`
+	// RequestClient is the value of param RequestClient for HmacSHA1 signed requests
+	RequestClient string `json:"requestClient,omitempty"`
+	// RetryPolicy is shared by ip assignment, unassignment, migration and interface operations, if not set, their own
+	// retry and interval are used as fixed interval retry
+	RetryPolicy *RetryPolicy `json:"retryPolicy,omitempty"`
+	// InterfaceOp is used by network interface create, attach, detach and delete
+	InterfaceOp InterfaceOp `json:"interfaceOp,omitempty"`
+	// InstanceTypeLimits is network interface quota keyed by instance type, like "S5.LARGE8"
+	InstanceTypeLimits map[string]InterfaceLimit `json:"instanceTypeLimits,omitempty"`
+	// MetadataEndpoint is endpoint of metadata service, default to http://metadata.tencentyun.com/latest/meta-data/
+	MetadataEndpoint string `json:"metadataEndpoint,omitempty"`
+	// Picker defines options for interface picker selected by policy
+	Picker PickerOptions `json:"picker,omitempty"`
+	// Credentials defines where to get credential, secretID and secretKey are used if not set
+	Credentials *CredentialsConfig `json:"credentials,omitempty"`
+	// TLS defines how to verify API endpoints, certificates are verified with system CAs if not set
+	TLS *TLSConfig `json:"tls,omitempty"`
+	// Transport defines proxy and dialer to connect to API endpoints
+	Transport *TransportConfig `json:"transport,omitempty"`
+	// RequestTimeout is timeout in ms of each API request, including connecting, waiting for response and reading
+	// response body, default to 30000
+	RequestTimeout int `json:"requestTimeout,omitempty"`
+	// MaxResponseBodySize is the max size in bytes of API response body, default to 10MiB
+	MaxResponseBodySize int64 `json:"maxResponseBodySize,omitempty"`
+	// RateLimit limits API requests of client, and of all processes on the node if node is set, no limit if not set
+	RateLimit *RateLimitConfig `json:"rateLimit,omitempty"`
+	// CircuitBreaker fails requests fast when an endpoint and action keeps failing, disabled if not set
+	CircuitBreaker *BreakerConfig `json:"circuitBreaker,omitempty"`
 }